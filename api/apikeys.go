@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+const (
+	ScopeCoursesRead Scope = "courses:read"
+	ScopeOrdersRead  Scope = "orders:read"
+	ScopeOrdersWrite Scope = "orders:write"
+	// ScopeEnrollmentsRead grants reading the enrollments of any user,
+	// which tells which courses a person takes.
+	ScopeEnrollmentsRead Scope = "enrollments:read"
+	// ScopeAdmin grants every other scope as well.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopes = []Scope{
+	ScopeCoursesRead,
+	ScopeOrdersRead,
+	ScopeOrdersWrite,
+	ScopeEnrollmentsRead,
+	ScopeAdmin,
+}
+
+const apiKeyPrefix = "ck_"
+
+// APIKey authenticates a client of the API. Only a hash of the key is
+// stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Key is only returned when the key is created.
+	Key string `json:"key,omitempty"`
+	// Prefix is the start of the key, to tell keys apart in listings.
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// Allows reports whether the key grants scope.
+func (k *APIKey) Allows(scope Scope) bool {
+	return k.RevokedAt.IsZero() && (slices.Contains(k.Scopes, ScopeAdmin) || slices.Contains(k.Scopes, scope))
+}
+
+// hashAPIKey returns the hash keys are stored and looked up by. Keys are
+// random, so a plain SHA-256 is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey returns a random key.
+func newAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func validateAPIKey(k *APIKey) ValidationErrors {
+	var errs ValidationErrors
+	if strings.TrimSpace(k.Name) == "" {
+		errs.Add("name", "API key name is required")
+	}
+	if len(k.Scopes) == 0 {
+		errs.Add("scopes", "API key must have at least one scope")
+	}
+	for i, scope := range k.Scopes {
+		if !slices.Contains(scopes, scope) {
+			errs.Add(fmt.Sprintf("scopes[%d]", i), "Unknown scope "+string(scope))
+		}
+	}
+	return errs
+}
+
+// CreateAPIKeyHandler issues a new key with the requested scopes. The key
+// is only returned in this response.
+func (s *Server) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Name   string  `json:"name"`
+		Scopes []Scope `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	apiKey := APIKey{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		CreatedAt: s.Clock.Now(),
+	}
+	if errs := validateAPIKey(&apiKey); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error generating key")
+		return
+	}
+	apiKey.Hash = hashAPIKey(key)
+	apiKey.Prefix = key[:len(apiKeyPrefix)+8]
+
+	if err := s.Store.CreateAPIKey(r.Context(), &apiKey); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving API key")
+		return
+	}
+	apiKey.Key = key
+
+	jsonResponse, err := json.Marshal(apiKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	keys, err := s.Store.ListAPIKeys(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading API keys")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(map[string]interface{}{"api_keys": keys})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// RevokeAPIKeyHandler stops the key from authenticating. Revoked keys stay
+// listed.
+func (s *Server) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	err := s.Store.RevokeAPIKey(r.Context(), vars["key"], s.Clock.Now())
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		writeError(w, http.StatusNotFound, CodeAPIKeyNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving API key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrCartNotFound   = errors.New("cart not found")
+	ErrCartCheckedOut = errors.New("cart has already been checked out")
+)
+
+// Cart collects courses before they are bought in a single order. Only
+// the course and quantity of its items are stored; prices are computed
+// whenever the cart is read and locked in when it is checked out.
+type Cart struct {
+	ID         string      `json:"id"`
+	Items      []OrderItem `json:"items"`
+	Currency   string      `json:"currency,omitempty"`
+	Country    string      `json:"country,omitempty"`
+	CouponCode string      `json:"coupon_code,omitempty"`
+	// OrderID is set once the cart has been checked out.
+	OrderID   string    `json:"order_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CartRequest is the body of POST /carts and PUT /carts/{cart}.
+type CartRequest struct {
+	Items      []OrderItem `json:"items"`
+	Currency   string      `json:"currency"`
+	Country    string      `json:"country"`
+	CouponCode string      `json:"coupon_code"`
+}
+
+// CartResponse is a cart with its items priced and the order totals.
+type CartResponse struct {
+	*Cart
+	Items         []OrderItem `json:"items"`
+	Currency      string      `json:"currency"`
+	OriginalPrice float64     `json:"original_price"`
+	Discount      float64     `json:"discount"`
+	Subtotal      float64     `json:"subtotal"`
+	TaxName       string      `json:"tax_name,omitempty"`
+	TaxRate       float64     `json:"tax_rate"`
+	Tax           float64     `json:"tax"`
+	Total         float64     `json:"total"`
+}
+
+func (c *Cart) orderRequest() orderRequest {
+	items := make([]OrderItem, len(c.Items))
+	for i, item := range c.Items {
+		items[i] = OrderItem{Course: item.Course, Quantity: item.Quantity}
+	}
+	return orderRequest{
+		Items:      items,
+		Currency:   c.Currency,
+		Country:    c.Country,
+		CouponCode: c.CouponCode,
+	}
+}
+
+// readCartRequest decodes and validates the cart in the request body and
+// applies it to cart.
+func readCartRequest(w http.ResponseWriter, r *http.Request, cart *Cart) bool {
+	var body CartRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return false
+	}
+	req := orderRequest{
+		Items:      body.Items,
+		Currency:   body.Currency,
+		Country:    body.Country,
+		CouponCode: body.CouponCode,
+	}
+	if errs := req.validateQuote(); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return false
+	}
+
+	cart.Items = make([]OrderItem, len(req.Items))
+	for i, item := range req.Items {
+		cart.Items[i] = OrderItem{Course: item.Course, Quantity: item.Quantity}
+	}
+	cart.Currency = req.Currency
+	cart.Country = req.Country
+	cart.CouponCode = req.CouponCode
+	return true
+}
+
+// writeCart prices the cart and writes it with the given status. Carts
+// that can no longer be priced, for example because a course was
+// archived, are answered with the reason instead.
+func (s *Server) writeCart(w http.ResponseWriter, r *http.Request, cart *Cart, status int) {
+	quote, err := s.quoteOrder(r.Context(), cart.orderRequest())
+	if err != nil {
+		writeOrderError(w, err)
+		return
+	}
+
+	response := CartResponse{
+		Cart:          cart,
+		Items:         quote.Items,
+		Currency:      quote.Currency,
+		OriginalPrice: quote.OriginalPrice,
+		Discount:      quote.Discount,
+		Subtotal:      quote.Subtotal,
+		TaxName:       quote.TaxName,
+		TaxRate:       quote.TaxRate,
+		Tax:           quote.Tax,
+		Total:         quote.Total,
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) CreateCartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	now := s.Clock.Now()
+	cart := &Cart{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !readCartRequest(w, r, cart) {
+		return
+	}
+
+	// Price the cart before saving it so unknown courses, currencies and
+	// coupons are rejected up front.
+	if _, err := s.quoteOrder(r.Context(), cart.orderRequest()); err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	if err := s.Store.CreateCart(r.Context(), cart); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving cart")
+		return
+	}
+
+	s.writeCart(w, r, cart, http.StatusCreated)
+}
+
+func (s *Server) GetCartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cart, ok := s.getCart(w, r)
+	if !ok {
+		return
+	}
+	s.writeCart(w, r, cart, http.StatusOK)
+}
+
+// ReplaceCartHandler replaces the items, currency, country and coupon of
+// a cart that has not been checked out yet.
+func (s *Server) ReplaceCartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	cart, ok := s.getCart(w, r)
+	if !ok {
+		return
+	}
+	if !readCartRequest(w, r, cart) {
+		return
+	}
+	if _, err := s.quoteOrder(r.Context(), cart.orderRequest()); err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	cart.UpdatedAt = s.Clock.Now()
+
+	err := s.Store.UpdateCart(r.Context(), cart)
+	if errors.Is(err, ErrCartCheckedOut) {
+		writeError(w, http.StatusConflict, CodeCartCheckedOut, "Cart has already been checked out")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving cart")
+		return
+	}
+
+	s.writeCart(w, r, cart, http.StatusOK)
+}
+
+// CheckoutCartHandler turns the cart into a pending order for the buyer
+// and returns the order id and payment URL, like POST /orders.
+func (s *Server) CheckoutCartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	type CheckoutCartRequest struct {
+		UserName  string `json:"user_name"`
+		UserEmail string `json:"user_email"`
+	}
+
+	var body CheckoutCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	cart, ok := s.getCart(w, r)
+	if !ok {
+		return
+	}
+	if cart.OrderID != "" {
+		writeError(w, http.StatusConflict, CodeCartCheckedOut, "Cart has already been checked out")
+		return
+	}
+	req := cart.orderRequest()
+	req.UserName = body.UserName
+	req.UserEmail = body.UserEmail
+	if errs := req.validate(); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+	order, err := s.quoteOrder(r.Context(), req)
+	if err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	order.ID = uuid.New().String()
+
+	s.placeOrder(w, r, order, func(ctx context.Context, order *Order) error {
+		return s.Store.CheckoutCart(ctx, cart.ID, order)
+	})
+}
+
+func (s *Server) getCart(w http.ResponseWriter, r *http.Request) (*Cart, bool) {
+	vars := mux.Vars(r)
+	cart, err := s.Store.GetCart(r.Context(), vars["cart"])
+	if errors.Is(err, ErrCartNotFound) {
+		writeError(w, http.StatusNotFound, CodeCartNotFound, "Cart not found")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading cart")
+		return nil, false
+	}
+	return cart, true
+}
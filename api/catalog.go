@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var ErrInvalidCatalog = errors.New("invalid catalog")
+
+// Catalog is the course list loaded from the catalog file.
+type Catalog struct {
+	Courses []Course `json:"courses" yaml:"courses"`
+}
+
+// LoadCatalog reads and validates a catalog file.
+func LoadCatalog(path string) (*Catalog, error) {
+	var c Catalog
+	if err := decodeConfigFile(path, &c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCatalog, err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidCatalog, path, err)
+	}
+	return &c, nil
+}
+
+// Validate reports every problem in the catalog at once: invalid fields,
+// duplicate names and prices that are not positive.
+func (c *Catalog) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, course := range c.Courses {
+		if verrs := validateCourse(&course); len(verrs) > 0 {
+			errs = append(errs, fmt.Errorf("courses[%d] %q: %w", i, course.Name, verrs))
+		}
+		if course.Price <= 0 {
+			errs = append(errs, fmt.Errorf("courses[%d] %q: price must be positive", i, course.Name))
+		}
+		if seen[course.Name] {
+			errs = append(errs, fmt.Errorf("courses[%d] %q: duplicate course name", i, course.Name))
+		}
+		seen[course.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// ReloadCatalog loads the configured catalog file into the store. Courses
+// that are new are created and existing ones get the details from the
+// file, but keep whether they are archived, which is managed through the
+// admin endpoints. Active courses missing from the file are reported, not
+// removed, since orders refer to them. Nothing is written when the file is
+// invalid.
+func (s *Server) ReloadCatalog(ctx context.Context) error {
+	s.catalogMu.Lock()
+	defer s.catalogMu.Unlock()
+
+	catalog, err := LoadCatalog(s.Config.CatalogPath)
+	if err != nil {
+		return err
+	}
+
+	created, updated := 0, 0
+	inFile := make(map[string]bool, len(catalog.Courses))
+	for _, course := range catalog.Courses {
+		inFile[course.Name] = true
+
+		err := s.Store.CreateCourse(ctx, &course)
+		if errors.Is(err, ErrCourseExists) {
+			var existing *Course
+			existing, err = s.Store.GetCourse(ctx, course.Name)
+			if err == nil {
+				course.Archived = existing.Archived
+				err = s.Store.UpdateCourse(ctx, &course)
+				updated++
+			}
+		} else if err == nil {
+			created++
+		}
+		if err != nil {
+			return fmt.Errorf("save course %s: %w", course.Name, err)
+		}
+	}
+
+	active, err := s.Store.ListCourses(ctx, CourseFilter{})
+	if err != nil {
+		return fmt.Errorf("list courses: %w", err)
+	}
+	var missing []string
+	for _, course := range active {
+		if !inFile[course.Name] {
+			missing = append(missing, course.Name)
+		}
+	}
+
+	log.Printf("loaded catalog from %s: %d courses created, %d updated", s.Config.CatalogPath, created, updated)
+	if len(missing) > 0 {
+		log.Printf("courses not in %s were kept, archive them to stop selling them: %s", s.Config.CatalogPath, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (s *Server) ReloadCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := s.ReloadCatalog(r.Context())
+	if errors.Is(err, ErrInvalidCatalog) {
+		writeError(w, http.StatusUnprocessableEntity, CodeCatalogInvalid, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving catalog")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCatalog(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write catalog: %v", err)
+	}
+}
+
+func TestReloadCatalog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	s := &Server{Config: &Config{CatalogPath: path}, Store: NewMemoryStore()}
+
+	writeCatalog(t, path, `courses:
+  - name: go
+    display_name: Go
+    price: 100
+    currency: USD
+  - name: rust
+    display_name: Rust
+    price: 120
+    currency: USD
+  - name: zig
+    display_name: Zig
+    price: 90
+    currency: USD
+`)
+	if err := s.ReloadCatalog(ctx); err != nil {
+		t.Fatalf("ReloadCatalog: %v", err)
+	}
+	if err := s.Store.ArchiveCourse(ctx, "rust"); err != nil {
+		t.Fatalf("ArchiveCourse: %v", err)
+	}
+
+	writeCatalog(t, path, `courses:
+  - name: go
+    display_name: Go
+    description: Now with generics
+    price: 150
+    currency: USD
+  - name: rust
+    display_name: Rust
+    price: 130
+    currency: USD
+  - name: python
+    display_name: Python
+    price: 80
+    currency: USD
+`)
+	if err := s.ReloadCatalog(ctx); err != nil {
+		t.Fatalf("ReloadCatalog: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		wantPrice    float64
+		wantArchived bool
+	}{
+		{name: "go", wantPrice: 150},
+		{name: "rust", wantPrice: 130, wantArchived: true},
+		{name: "python", wantPrice: 80},
+		// Removed from the file, but kept for the orders referring to it.
+		{name: "zig", wantPrice: 90},
+	}
+	for _, tt := range tests {
+		course, err := s.Store.GetCourse(ctx, tt.name)
+		if err != nil {
+			t.Fatalf("GetCourse(%s): %v", tt.name, err)
+		}
+		if course.Price != tt.wantPrice || course.Archived != tt.wantArchived {
+			t.Errorf("%s: price, archived = %v, %v, want %v, %v", tt.name, course.Price, course.Archived, tt.wantPrice, tt.wantArchived)
+		}
+	}
+	if course, _ := s.Store.GetCourse(ctx, "go"); course.Description != "Now with generics" {
+		t.Errorf("go description = %q, want the one from the file", course.Description)
+	}
+}
+
+func TestReloadCatalogKeepsCoursesWhenInvalid(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	s := &Server{Config: &Config{CatalogPath: path}, Store: NewMemoryStore()}
+
+	writeCatalog(t, path, "courses:\n  - name: go\n    display_name: Go\n    price: 100\n    currency: USD\n")
+	if err := s.ReloadCatalog(ctx); err != nil {
+		t.Fatalf("ReloadCatalog: %v", err)
+	}
+
+	writeCatalog(t, path, "courses:\n  - name: go\n    display_name: Go\n    price: -1\n    currency: USD\n")
+	if err := s.ReloadCatalog(ctx); !errors.Is(err, ErrInvalidCatalog) {
+		t.Fatalf("ReloadCatalog error = %v, want %v", err, ErrInvalidCatalog)
+	}
+	if course, err := s.Store.GetCourse(ctx, "go"); err != nil || course.Price != 100 {
+		t.Errorf("go = %+v, %v, want the price from the valid file", course, err)
+	}
+}
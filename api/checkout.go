@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed templates/checkout.html
+var checkoutFS embed.FS
+
+// checkoutTemplate is parsed with placeholder functions; "t" is replaced
+// per request with the translator for the negotiated language.
+var checkoutTemplate = template.Must(template.New("checkout.html").
+	Funcs(template.FuncMap{
+		"t":       func(key string) string { return key },
+		"money":   formatMoney,
+		"percent": emailFuncs["percent"],
+		"date":    func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+	}).
+	ParseFS(checkoutFS, "templates/checkout.html"))
+
+// checkoutMessages holds the checkout page text by language. English is
+// the fallback for missing languages and keys.
+var checkoutMessages = map[string]map[string]string{
+	"en": {
+		"title":            "Checkout",
+		"order":            "Order",
+		"buyer":            "Buyer",
+		"course":           "Course",
+		"quantity":         "Seats",
+		"amount":           "Amount",
+		"discount":         "Discount",
+		"subtotal":         "Subtotal",
+		"total":            "Total",
+		"expires_at":       "Please pay before",
+		"pay_now":          "Pay now",
+		"paid_notice":      "Thank you! This order was paid on",
+		"expired_notice":   "This order has expired and can no longer be paid. Please place a new order.",
+		"cancelled_notice": "This order was cancelled.",
+		"refunded_notice":  "This order was refunded.",
+		"status_pending":   "Awaiting payment",
+		"status_paid":      "Paid",
+		"status_expired":   "Expired",
+		"status_cancelled": "Cancelled",
+		"status_refunded":  "Refunded",
+	},
+	"id": {
+		"title":            "Pembayaran",
+		"order":            "Pesanan",
+		"buyer":            "Pembeli",
+		"course":           "Kursus",
+		"quantity":         "Kursi",
+		"amount":           "Jumlah",
+		"discount":         "Diskon",
+		"subtotal":         "Subtotal",
+		"total":            "Total",
+		"expires_at":       "Harap bayar sebelum",
+		"pay_now":          "Bayar sekarang",
+		"paid_notice":      "Terima kasih! Pesanan ini telah dibayar pada",
+		"expired_notice":   "Pesanan ini sudah kedaluwarsa dan tidak dapat dibayar lagi. Silakan buat pesanan baru.",
+		"cancelled_notice": "Pesanan ini telah dibatalkan.",
+		"refunded_notice":  "Pesanan ini telah dikembalikan dananya.",
+		"status_pending":   "Menunggu pembayaran",
+		"status_paid":      "Lunas",
+		"status_expired":   "Kedaluwarsa",
+		"status_cancelled": "Dibatalkan",
+		"status_refunded":  "Dikembalikan",
+	},
+	"de": {
+		"title":            "Kasse",
+		"order":            "Bestellung",
+		"buyer":            "Käufer",
+		"course":           "Kurs",
+		"quantity":         "Plätze",
+		"amount":           "Betrag",
+		"discount":         "Rabatt",
+		"subtotal":         "Zwischensumme",
+		"total":            "Gesamt",
+		"expires_at":       "Bitte bezahlen Sie vor",
+		"pay_now":          "Jetzt bezahlen",
+		"paid_notice":      "Vielen Dank! Diese Bestellung wurde bezahlt am",
+		"expired_notice":   "Diese Bestellung ist abgelaufen und kann nicht mehr bezahlt werden. Bitte geben Sie eine neue Bestellung auf.",
+		"cancelled_notice": "Diese Bestellung wurde storniert.",
+		"refunded_notice":  "Diese Bestellung wurde erstattet.",
+		"status_pending":   "Zahlung ausstehend",
+		"status_paid":      "Bezahlt",
+		"status_expired":   "Abgelaufen",
+		"status_cancelled": "Storniert",
+		"status_refunded":  "Erstattet",
+	},
+	"es": {
+		"title":            "Pago",
+		"order":            "Pedido",
+		"buyer":            "Comprador",
+		"course":           "Curso",
+		"quantity":         "Plazas",
+		"amount":           "Importe",
+		"discount":         "Descuento",
+		"subtotal":         "Subtotal",
+		"total":            "Total",
+		"expires_at":       "Por favor, paga antes de",
+		"pay_now":          "Pagar ahora",
+		"paid_notice":      "¡Gracias! Este pedido se pagó el",
+		"expired_notice":   "Este pedido ha caducado y ya no se puede pagar. Por favor, realiza un nuevo pedido.",
+		"cancelled_notice": "Este pedido fue cancelado.",
+		"refunded_notice":  "Este pedido fue reembolsado.",
+		"status_pending":   "Pendiente de pago",
+		"status_paid":      "Pagado",
+		"status_expired":   "Caducado",
+		"status_cancelled": "Cancelado",
+		"status_refunded":  "Reembolsado",
+	},
+}
+
+// negotiateLanguage picks the supported language the client prefers most
+// from an Accept-Language header, falling back to English.
+func negotiateLanguage(header string) string {
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		// Match on the primary subtag so "de-AT" gets German.
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := checkoutMessages[lang]; ok && q > 0 {
+			choices = append(choices, choice{lang, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	if len(choices) == 0 {
+		return "en"
+	}
+	return choices[0].lang
+}
+
+// checkoutItem is an order line item with the course details shown on
+// the checkout page.
+type checkoutItem struct {
+	Name        string
+	Description string
+	Quantity    int
+	Amount      float64
+}
+
+// OrderPaymentPageHandler renders the checkout page of an order. Pending
+// orders get a pay button; paid, expired, cancelled and refunded orders
+// get a summary explaining their status. Expired orders are answered
+// with 410 Gone.
+func (s *Server) OrderPaymentPageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["order"]
+
+	// Get order from database
+	order, err := s.Store.GetOrder(r.Context(), orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading order", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]checkoutItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		ci := checkoutItem{Name: item.DisplayName, Quantity: item.Quantity, Amount: item.Amount}
+		if course, err := s.Store.GetCourse(r.Context(), item.Course); err == nil {
+			ci.Name = course.DisplayName
+			ci.Description = course.Description
+		}
+		if ci.Name == "" {
+			ci.Name = item.Course
+		}
+		items = append(items, ci)
+	}
+
+	expired := order.Status == OrderStatusExpired || order.IsExpired(s.Clock.Now())
+	data := struct {
+		Lang    string
+		Order   *Order
+		Items   []checkoutItem
+		Expired bool
+		Payable bool
+		PayURL  string
+	}{
+		Lang:    negotiateLanguage(r.Header.Get("Accept-Language")),
+		Order:   order,
+		Items:   items,
+		Expired: expired,
+		Payable: order.Status == OrderStatusPending && !expired,
+		PayURL:  "/orders/" + order.ID + ":pay?token=" + signOrderToken([]byte(s.Config.OrderTokenSecret), order.ID),
+	}
+
+	page, err := renderCheckout(data.Lang, data)
+	if err != nil {
+		log.Printf("render checkout page for order %s error: %v", order.ID, err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if expired {
+		status = http.StatusGone
+	}
+
+	// Set content type and write HTML
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", data.Lang)
+	w.Header().Set("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	w.Write(page)
+}
+
+// renderCheckout executes the checkout template with its text in lang.
+func renderCheckout(lang string, data interface{}) ([]byte, error) {
+	tmpl, err := checkoutTemplate.Clone()
+	if err != nil {
+		return nil, err
+	}
+	messages, fallback := checkoutMessages[lang], checkoutMessages["en"]
+	tmpl.Funcs(template.FuncMap{"t": func(key string) string {
+		if m, ok := messages[key]; ok {
+			return m
+		}
+		return fallback[key]
+	}})
+
+	var page bytes.Buffer
+	if err := tmpl.Execute(&page, data); err != nil {
+		return nil, err
+	}
+	return page.Bytes(), nil
+}
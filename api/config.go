@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the runtime settings of the API. Values come from
+// COURSES_API_* environment variables.
+type Config struct {
+	// PaymentWindow is how long a pending order can be paid before it
+	// expires.
+	PaymentWindow time.Duration
+	// ExpiryInterval is how often the background worker looks for
+	// pending orders past their payment window.
+	ExpiryInterval time.Duration
+
+	// IdempotencyTTL is how long a completed request is replayed for its
+	// Idempotency-Key. IdempotencyStaleAfter is how long a request may stay
+	// in progress before its key is considered abandoned and can be used
+	// again.
+	IdempotencyTTL        time.Duration
+	IdempotencyStaleAfter time.Duration
+
+	// BaseURL is the public URL of the API. It is used to build checkout
+	// links and the mock provider's webhook destination.
+	BaseURL string
+	// PaymentProvider selects the payment gateway. Only "mock" is
+	// supported.
+	PaymentProvider string
+	// PaymentWebhookSecret is the HMAC key payment webhooks are signed
+	// with.
+	PaymentWebhookSecret string
+
+	// AdminToken is a bearer token granting every scope, used to create
+	// the first API keys. It is disabled when empty.
+	AdminToken string
+	// OrderTokenSecret is the HMAC key of the tokens in payment page
+	// links. A random key is used when it is empty, which invalidates
+	// links on restart and does not work across replicas.
+	OrderTokenSecret string
+
+	// CatalogPath is the YAML or JSON file the course catalog is loaded
+	// from at startup and on reload.
+	CatalogPath string
+	// ExchangeRatesPath is the YAML or JSON file exchange rates are
+	// loaded from. Orders can only be placed in currencies without an
+	// explicit course price when it is set.
+	ExchangeRatesPath string
+	// TaxRatesPath is the YAML or JSON file the tax rates by buyer
+	// country are loaded from.
+	TaxRatesPath string
+	// DefaultCountry is the buyer country assumed for POST /orders
+	// requests without one. Such orders are not taxed when it is empty.
+	DefaultCountry string
+
+	// RateLimitsPath is the YAML or JSON file the per-route rate limits
+	// are loaded from. Requests are not limited when it is empty.
+	RateLimitsPath string
+	// TrustForwardedFor makes rate limiting key anonymous callers by the
+	// last X-Forwarded-For address, the one our proxy appended, instead
+	// of the connection address. Only enable it behind a single proxy that
+	// sets the header.
+	TrustForwardedFor bool
+
+	// WebhookInterval is how often the outbox is checked for webhook
+	// deliveries that are due.
+	WebhookInterval time.Duration
+	// WebhookMaxAttempts is how many times a delivery is tried before it
+	// is marked failed.
+	WebhookMaxAttempts int
+
+	// Mailer selects how email is sent: "file" writes messages to MailDir,
+	// "smtp" sends them through SMTPAddr.
+	Mailer       string
+	MailDir      string
+	MailFrom     string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	// MailInterval is how often the email outbox is processed and
+	// MailMaxAttempts how many times an email is tried before it is
+	// marked failed.
+	MailInterval    time.Duration
+	MailMaxAttempts int
+	// ReminderBefore is how long before an order expires its buyer is
+	// reminded to pay.
+	ReminderBefore time.Duration
+}
+
+func LoadConfig() (*Config, error) {
+	paymentWindow, err := envDuration("COURSES_API_PAYMENT_WINDOW", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	expiryInterval, err := envDuration("COURSES_API_EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	idempotencyTTL, err := envDuration("COURSES_API_IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	idempotencyStaleAfter, err := envDuration("COURSES_API_IDEMPOTENCY_STALE_AFTER", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	webhookInterval, err := envDuration("COURSES_API_WEBHOOK_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	webhookMaxAttempts, err := envInt("COURSES_API_WEBHOOK_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return nil, err
+	}
+	mailInterval, err := envDuration("COURSES_API_MAIL_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	mailMaxAttempts, err := envInt("COURSES_API_MAIL_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return nil, err
+	}
+	reminderBefore, err := envDuration("COURSES_API_REMINDER_BEFORE", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	defaultCountry := strings.ToUpper(os.Getenv("COURSES_API_DEFAULT_COUNTRY"))
+	if defaultCountry != "" && !countryCodePattern.MatchString(defaultCountry) {
+		return nil, fmt.Errorf("invalid COURSES_API_DEFAULT_COUNTRY: %q is not an ISO 3166 country code", defaultCountry)
+	}
+	trustForwardedFor, err := envBool("COURSES_API_TRUST_FORWARDED_FOR")
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		PaymentWindow:         paymentWindow,
+		ExpiryInterval:        expiryInterval,
+		IdempotencyTTL:        idempotencyTTL,
+		IdempotencyStaleAfter: idempotencyStaleAfter,
+		BaseURL:               strings.TrimSuffix(envString("COURSES_API_BASE_URL", "http://localhost:8080"), "/"),
+		PaymentProvider:       envString("COURSES_API_PAYMENT_PROVIDER", "mock"),
+		PaymentWebhookSecret:  os.Getenv("COURSES_API_PAYMENT_WEBHOOK_SECRET"),
+		AdminToken:            os.Getenv("COURSES_API_ADMIN_TOKEN"),
+		OrderTokenSecret:      os.Getenv("COURSES_API_ORDER_TOKEN_SECRET"),
+		CatalogPath:           envString("COURSES_API_CATALOG", "catalog.yaml"),
+		ExchangeRatesPath:     envString("COURSES_API_EXCHANGE_RATES", "exchange_rates.yaml"),
+		TaxRatesPath:          envString("COURSES_API_TAX_RATES", "tax_rates.yaml"),
+		DefaultCountry:        defaultCountry,
+		RateLimitsPath:        envString("COURSES_API_RATE_LIMITS", "rate_limits.yaml"),
+		TrustForwardedFor:     trustForwardedFor,
+		WebhookInterval:       webhookInterval,
+		WebhookMaxAttempts:    webhookMaxAttempts,
+		Mailer:                envString("COURSES_API_MAILER", "file"),
+		MailDir:               envString("COURSES_API_MAIL_DIR", "mail"),
+		MailFrom:              envString("COURSES_API_MAIL_FROM", "Courses <no-reply@localhost>"),
+		SMTPAddr:              os.Getenv("COURSES_API_SMTP_ADDR"),
+		SMTPUsername:          os.Getenv("COURSES_API_SMTP_USERNAME"),
+		SMTPPassword:          os.Getenv("COURSES_API_SMTP_PASSWORD"),
+		MailInterval:          mailInterval,
+		MailMaxAttempts:       mailMaxAttempts,
+		ReminderBefore:        reminderBefore,
+	}, nil
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive", key)
+	}
+	return d, nil
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive", key)
+	}
+	return n, nil
+}
+
+func envBool(key string) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// decodeConfigFile decodes the file at path into v. Files ending in .json
+// are decoded as JSON, everything else as YAML; unknown fields are
+// rejected either way.
+func decodeConfigFile(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(v)
+	default:
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(v)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigDefaultCountry(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "unset", value: "", want: ""},
+		{name: "set", value: "DE", want: "DE"},
+		{name: "lower case", value: "fr", want: "FR"},
+		{name: "invalid", value: "Germany", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COURSES_API_DEFAULT_COUNTRY", tt.value)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadConfig() = %+v, want an error", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.DefaultCountry != tt.want {
+				t.Errorf("DefaultCountry = %q, want %q", cfg.DefaultCountry, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigFile(t *testing.T) {
+	type file struct {
+		Name string `json:"name" yaml:"name"`
+	}
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "yaml", file: "f.yaml", content: "name: go\n", want: "go"},
+		{name: "json", file: "f.json", content: `{"name": "go"}`, want: "go"},
+		{name: "upper case extension", file: "f.JSON", content: `{"name": "go"}`, want: "go"},
+		{name: "unknown yaml field", file: "f.yaml", content: "name: go\nprice: 1\n", wantErr: true},
+		{name: "unknown json field", file: "f.json", content: `{"name": "go", "price": 1}`, wantErr: true},
+		{name: "json read as yaml", file: "f.yml", content: `{"name": "go"}`, want: "go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+
+			var got file
+			err := decodeConfigFile(path, &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeConfigFile() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeConfigFile: %v", err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("name = %q, want %q", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadShippedConfigFiles(t *testing.T) {
+	if _, err := LoadCatalog("catalog.yaml"); err != nil {
+		t.Errorf("LoadCatalog: %v", err)
+	}
+	if _, err := LoadTaxTable("tax_rates.yaml"); err != nil {
+		t.Errorf("LoadTaxTable: %v", err)
+	}
+	if _, err := LoadExchangeRates("exchange_rates.yaml"); err != nil {
+		t.Errorf("LoadExchangeRates: %v", err)
+	}
+	if _, err := LoadRateLimits("rate_limits.yaml"); err != nil {
+		t.Errorf("LoadRateLimits: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponExists        = errors.New("coupon already exists")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponExhausted     = errors.New("coupon has reached its usage limit")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this course")
+)
+
+type CouponType string
+
+const (
+	// CouponTypePercent takes Value percent off the course price.
+	CouponTypePercent CouponType = "percent"
+	// CouponTypeFixed takes Value in Currency off the course price.
+	CouponTypeFixed CouponType = "fixed"
+)
+
+type Coupon struct {
+	Code     string     `json:"code"`
+	Type     CouponType `json:"type"`
+	Value    float64    `json:"value"`
+	Currency string     `json:"currency,omitempty"`
+	// Courses limits the coupon to these course names. An empty list
+	// applies to every course.
+	Courses   []string  `json:"courses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MaxRedemptions is how many orders may use the coupon; 0 means
+	// unlimited.
+	MaxRedemptions int       `json:"max_redemptions"`
+	Redemptions    int       `json:"redemptions"`
+	Disabled       bool      `json:"disabled"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,31}$`)
+
+// normalizeCouponCode makes codes case-insensitive, since buyers often
+// read them out loud.
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validateCoupon(c *Coupon) ValidationErrors {
+	var errs ValidationErrors
+	if !couponCodePattern.MatchString(c.Code) {
+		errs.Add("code", "Coupon code must be 3 to 32 letters, digits, dashes or underscores")
+	}
+	switch {
+	case c.Type == CouponTypePercent && (c.Value <= 0 || c.Value > 100):
+		errs.Add("value", "Percent coupon value must be between 0 and 100")
+	case c.Type == CouponTypeFixed && c.Value <= 0:
+		errs.Add("value", "Fixed coupon value must be positive")
+	case c.Type != CouponTypePercent && c.Type != CouponTypeFixed:
+		errs.Add("type", "Coupon type must be percent or fixed")
+	}
+	if c.Type == CouponTypeFixed && !isCurrencyCode(c.Currency) {
+		errs.Add("currency", "Fixed coupon currency must be a three letter ISO 4217 code")
+	}
+	if c.MaxRedemptions < 0 {
+		errs.Add("max_redemptions", "Coupon max_redemptions must not be negative")
+	}
+	return errs
+}
+
+// Discount returns how much the coupon takes off the line items, charged
+// in the given currency, at the given time, or why it cannot be used. A
+// coupon limited to some courses only discounts their line items.
+func (c *Coupon) Discount(items []OrderItem, currency string, now time.Time) (float64, error) {
+	if c.Disabled {
+		return 0, ErrCouponNotFound
+	}
+	if !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt) {
+		return 0, ErrCouponExpired
+	}
+	if c.MaxRedemptions > 0 && c.Redemptions >= c.MaxRedemptions {
+		return 0, ErrCouponExhausted
+	}
+
+	var eligible float64
+	applies := false
+	for _, item := range items {
+		if len(c.Courses) == 0 || slices.Contains(c.Courses, item.Course) {
+			eligible += item.Amount
+			applies = true
+		}
+	}
+	if !applies {
+		return 0, ErrCouponNotApplicable
+	}
+
+	var discount float64
+	switch c.Type {
+	case CouponTypePercent:
+		discount = roundCurrency(eligible*c.Value/100, currency)
+	case CouponTypeFixed:
+		if c.Currency != currency {
+			return 0, ErrCouponNotApplicable
+		}
+		discount = c.Value
+	}
+	return min(discount, eligible), nil
+}
+
+// writeCouponError explains to the buyer why a coupon was rejected.
+func writeCouponError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCouponNotFound):
+		writeError(w, http.StatusUnprocessableEntity, CodeCouponInvalid, "Coupon code is not valid")
+	case errors.Is(err, ErrCouponExpired):
+		writeError(w, http.StatusUnprocessableEntity, CodeCouponExpired, "Coupon code has expired")
+	case errors.Is(err, ErrCouponExhausted):
+		writeError(w, http.StatusUnprocessableEntity, CodeCouponExhausted, "Coupon code has been fully redeemed")
+	case errors.Is(err, ErrCouponNotApplicable):
+		writeError(w, http.StatusUnprocessableEntity, CodeCouponNotApplicable, "Coupon code does not apply to this course")
+	default:
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error applying coupon")
+	}
+}
+
+func (s *Server) CreateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var coupon Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	coupon.Code = normalizeCouponCode(coupon.Code)
+	coupon.Currency = strings.ToUpper(coupon.Currency)
+	coupon.Redemptions = 0
+	coupon.Disabled = false
+	coupon.CreatedAt = s.Clock.Now()
+	if coupon.Courses == nil {
+		coupon.Courses = []string{}
+	}
+	errs := validateCoupon(&coupon)
+	for i, name := range coupon.Courses {
+		if _, err := s.Store.GetCourse(r.Context(), name); err != nil {
+			errs.Add(fmt.Sprintf("courses[%d]", i), "Coupon references unknown course "+name)
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	err := s.Store.CreateCoupon(r.Context(), &coupon)
+	if errors.Is(err, ErrCouponExists) {
+		writeError(w, http.StatusConflict, CodeCouponExists, "Coupon already exists")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving coupon")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(coupon)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) ListCouponsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	coupons, err := s.Store.ListCoupons(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading coupons")
+		return
+	}
+
+	type ListCouponsResponse struct {
+		Coupons []Coupon `json:"coupons"`
+	}
+
+	jsonResponse, err := json.Marshal(ListCouponsResponse{Coupons: coupons})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) GetCouponHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	code := normalizeCouponCode(vars["coupon"])
+
+	coupon, err := s.Store.GetCoupon(r.Context(), code)
+	if errors.Is(err, ErrCouponNotFound) {
+		writeError(w, http.StatusNotFound, CodeCouponNotFound, "Coupon not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading coupon")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(coupon)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// DisableCouponHandler stops the coupon from being used by new orders.
+// Orders that already used it keep their discount.
+func (s *Server) DisableCouponHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	code := normalizeCouponCode(vars["coupon"])
+
+	err := s.Store.DisableCoupon(r.Context(), code)
+	if errors.Is(err, ErrCouponNotFound) {
+		writeError(w, http.StatusNotFound, CodeCouponNotFound, "Coupon not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving coupon")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ListCoursesHandler lists the catalog sorted by order_by ("name",
+// "name desc", "price" or "price desc", default "name"). q filters on
+// display name and description. Pages are requested with page_size and
+// the next_page_token of the previous page.
+func (s *Server) ListCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	filter := CourseFilter{
+		Query:   strings.TrimSpace(q.Get("q")),
+		OrderBy: CourseOrder(q.Get("order_by")),
+	}
+	if filter.OrderBy == "" {
+		filter.OrderBy = CourseOrderName
+	}
+	if !filter.OrderBy.Valid() {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "order_by must be one of name, name desc, price or price desc")
+		return
+	}
+	if v := q.Get("page_token"); v != "" {
+		cursor, err := decodeCourseCursor(v, filter.OrderBy)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid page_token")
+			return
+		}
+		filter.After = cursor
+	}
+	pageSize, err := parsePageSize(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	// Fetch one extra course to know whether there is a next page.
+	filter.Limit = pageSize + 1
+
+	courses, err := s.Store.ListCourses(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading courses")
+		return
+	}
+
+	type ListCoursesResponse struct {
+		Courses       []Course `json:"courses"`
+		NextPageToken string   `json:"next_page_token,omitempty"`
+	}
+
+	response := ListCoursesResponse{Courses: courses}
+	if len(courses) > pageSize {
+		response.Courses = courses[:pageSize]
+		last := response.Courses[pageSize-1]
+		response.NextPageToken = courseCursor{OrderBy: filter.OrderBy, Price: last.Price, Name: last.Name}.Encode()
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) GetCourseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	courseName := vars["course"]
+
+	course, err := s.Store.GetCourse(r.Context(), courseName)
+	if errors.Is(err, ErrCourseNotFound) {
+		writeError(w, http.StatusNotFound, CodeCourseNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading course")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(course)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+var courseNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validateCourse returns a user facing message for every invalid field of
+// the course.
+func validateCourse(c *Course) ValidationErrors {
+	var errs ValidationErrors
+	if !courseNamePattern.MatchString(c.Name) {
+		errs.Add("name", "Course name must be a lowercase slug such as software-security")
+	}
+	if strings.TrimSpace(c.DisplayName) == "" {
+		errs.Add("display_name", "Course display_name is required")
+	}
+	if c.Price < 0 {
+		errs.Add("price", "Course price must not be negative")
+	}
+	if !isCurrencyCode(c.Currency) {
+		errs.Add("currency", "Course currency must be a three letter ISO 4217 code")
+	}
+	if c.Prices.Validate() != nil {
+		errs.Add("prices", "Course prices must be positive amounts keyed by ISO 4217 currency codes")
+	}
+	return errs
+}
+
+func (s *Server) CreateCourseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var course Course
+	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	course.Archived = false
+	if errs := validateCourse(&course); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	err := s.Store.CreateCourse(r.Context(), &course)
+	if errors.Is(err, ErrCourseExists) {
+		writeError(w, http.StatusConflict, CodeCourseExists, "Course already exists")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving course")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(course)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonResponse)
+}
+
+// ReplaceCourseHandler overwrites every editable field of the course. The
+// name is the course identifier and cannot be changed.
+func (s *Server) ReplaceCourseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	courseName := vars["course"]
+
+	var course Course
+	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if course.Name != "" && course.Name != courseName {
+		writeValidationError(w, ValidationErrors{{Field: "name", Message: "Course name cannot be changed"}})
+		return
+	}
+	course.Name = courseName
+
+	s.saveCourse(w, r, func(existing *Course) {
+		course.Archived = existing.Archived
+		*existing = course
+	})
+}
+
+// UpdateCourseHandler changes only the fields present in the request body.
+func (s *Server) UpdateCourseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	type UpdateCourseRequest struct {
+		Name        *string  `json:"name"`
+		DisplayName *string  `json:"display_name"`
+		Description *string  `json:"description"`
+		Price       *float64 `json:"price"`
+		Currency    *string  `json:"currency"`
+		// Prices replaces the whole price list when present.
+		Prices *PriceList `json:"prices"`
+	}
+
+	vars := mux.Vars(r)
+	courseName := vars["course"]
+
+	var req UpdateCourseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Name != nil && *req.Name != courseName {
+		writeValidationError(w, ValidationErrors{{Field: "name", Message: "Course name cannot be changed"}})
+		return
+	}
+
+	s.saveCourse(w, r, func(c *Course) {
+		if req.DisplayName != nil {
+			c.DisplayName = *req.DisplayName
+		}
+		if req.Description != nil {
+			c.Description = *req.Description
+		}
+		if req.Price != nil {
+			c.Price = *req.Price
+		}
+		if req.Currency != nil {
+			c.Currency = *req.Currency
+		}
+		if req.Prices != nil {
+			c.Prices = *req.Prices
+		}
+	})
+}
+
+// saveCourse loads the course in the path, applies update to it, validates
+// the result and stores it.
+func (s *Server) saveCourse(w http.ResponseWriter, r *http.Request, update func(c *Course)) {
+	vars := mux.Vars(r)
+	courseName := vars["course"]
+
+	course, err := s.Store.GetCourse(r.Context(), courseName)
+	if errors.Is(err, ErrCourseNotFound) {
+		writeError(w, http.StatusNotFound, CodeCourseNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading course")
+		return
+	}
+
+	update(course)
+	if errs := validateCourse(course); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	err = s.Store.UpdateCourse(r.Context(), course)
+	if errors.Is(err, ErrCourseNotFound) {
+		writeError(w, http.StatusNotFound, CodeCourseNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving course")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(course)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// ArchiveCourseHandler hides the course from the catalog and stops new
+// orders for it. The course itself is kept so existing orders still
+// resolve.
+func (s *Server) ArchiveCourseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	courseName := vars["course"]
+
+	err := s.Store.ArchiveCourse(r.Context(), courseName)
+	if errors.Is(err, ErrCourseNotFound) {
+		writeError(w, http.StatusNotFound, CodeCourseNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving course")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// iso4217 holds the active ISO 4217 currency codes.
+var iso4217 = map[string]bool{}
+
+func init() {
+	for _, code := range []string{
+		"AED", "AFN", "ALL", "AMD", "ANG", "AOA", "ARS", "AUD", "AWG", "AZN",
+		"BAM", "BBD", "BDT", "BGN", "BHD", "BIF", "BMD", "BND", "BOB", "BRL",
+		"BSD", "BTN", "BWP", "BYN", "BZD", "CAD", "CDF", "CHF", "CLP", "CNY",
+		"COP", "CRC", "CUP", "CVE", "CZK", "DJF", "DKK", "DOP", "DZD", "EGP",
+		"ERN", "ETB", "EUR", "FJD", "FKP", "GBP", "GEL", "GHS", "GIP", "GMD",
+		"GNF", "GTQ", "GYD", "HKD", "HNL", "HTG", "HUF", "IDR", "ILS", "INR",
+		"IQD", "IRR", "ISK", "JMD", "JOD", "JPY", "KES", "KGS", "KHR", "KMF",
+		"KPW", "KRW", "KWD", "KYD", "KZT", "LAK", "LBP", "LKR", "LRD", "LSL",
+		"LYD", "MAD", "MDL", "MGA", "MKD", "MMK", "MNT", "MOP", "MRU", "MUR",
+		"MVR", "MWK", "MXN", "MYR", "MZN", "NAD", "NGN", "NIO", "NOK", "NPR",
+		"NZD", "OMR", "PAB", "PEN", "PGK", "PHP", "PKR", "PLN", "PYG", "QAR",
+		"RON", "RSD", "RUB", "RWF", "SAR", "SBD", "SCR", "SDG", "SEK", "SGD",
+		"SHP", "SLE", "SOS", "SRD", "SSP", "STN", "SVC", "SYP", "SZL", "THB",
+		"TJS", "TMT", "TND", "TOP", "TRY", "TTD", "TWD", "TZS", "UAH", "UGX",
+		"USD", "UYU", "UZS", "VES", "VND", "VUV", "WST", "XAF", "XCD", "XOF",
+		"XPF", "YER", "ZAR", "ZMW", "ZWG",
+	} {
+		iso4217[code] = true
+	}
+}
+
+func isCurrencyCode(code string) bool {
+	return iso4217[code]
+}
+
+// currencyExponents lists the currencies whose minor unit is not 1/100.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// currencyExponent returns the number of decimals used by the currency.
+func currencyExponent(code string) int {
+	if e, ok := currencyExponents[code]; ok {
+		return e
+	}
+	return 2
+}
+
+// roundCurrency rounds an amount to the minor unit of the currency.
+func roundCurrency(amount float64, code string) float64 {
+	scale := math.Pow10(currencyExponent(code))
+	return math.Round(amount*scale) / scale
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "CNY": "CN¥", "INR": "₹",
+	"IDR": "Rp", "SGD": "S$", "AUD": "A$", "CAD": "CA$", "KRW": "₩", "MYR": "RM",
+	"PHP": "₱", "THB": "฿", "VND": "₫",
+}
+
+// formatMoney formats an amount for display, e.g. "$1,250.00", "¥15,000"
+// or "CHF 99.90" for currencies without a well-known symbol.
+func formatMoney(amount float64, code string) string {
+	exp := currencyExponent(code)
+	s := strconv.FormatFloat(math.Abs(roundCurrency(amount, code)), 'f', exp, 64)
+
+	whole, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteString("." + frac)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	symbol, ok := currencySymbols[code]
+	if !ok {
+		return sign + code + " " + b.String()
+	}
+	return sign + symbol + b.String()
+}
+
+// PriceList maps ISO 4217 currency codes to a price in that currency. It
+// is stored as JSONB.
+type PriceList map[string]float64
+
+func (p PriceList) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(p)
+}
+
+func (p *PriceList) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*p = PriceList{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into PriceList", src)
+	}
+	return json.Unmarshal(b, p)
+}
+
+func (p PriceList) Validate() error {
+	for code, price := range p {
+		if !isCurrencyCode(code) {
+			return fmt.Errorf("%s is not an ISO 4217 currency code", code)
+		}
+		if price <= 0 {
+			return errors.New("prices must be positive")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var ErrEmailExists = errors.New("email already queued")
+
+type EmailKind string
+
+const (
+	EmailOrderConfirmation EmailKind = "order_confirmation"
+	EmailPaymentReceipt    EmailKind = "payment_receipt"
+	EmailExpiryReminder    EmailKind = "expiry_reminder"
+)
+
+//go:embed emails/*.txt
+var emailFS embed.FS
+
+var emailFuncs = template.FuncMap{
+	"money": formatMoney,
+	"percent": func(rate float64) string {
+		return strconv.FormatFloat(rate*100, 'f', -1, 64) + "%"
+	},
+	// courses names the courses of an order for subject lines.
+	"courses": func(o *Order) string {
+		names := make([]string, 0, len(o.Items))
+		for _, item := range o.Items {
+			names = append(names, item.DisplayName)
+		}
+		if len(names) == 0 {
+			return o.Course
+		}
+		return strings.Join(names, ", ")
+	},
+}
+
+// emailTemplates holds one template per kind defining "subject" and
+// "body".
+var emailTemplates = map[EmailKind]*template.Template{}
+
+func init() {
+	for _, kind := range []EmailKind{EmailOrderConfirmation, EmailPaymentReceipt, EmailExpiryReminder} {
+		emailTemplates[kind] = template.Must(template.New(string(kind)).
+			Funcs(emailFuncs).
+			ParseFS(emailFS, "emails/breakdown.txt", "emails/"+string(kind)+".txt"))
+	}
+}
+
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	EmailStatusFailed  EmailStatus = "failed"
+)
+
+// Email is a rendered message in the outbox. Its ID is derived from the
+// kind and order so every order gets each email at most once.
+type Email struct {
+	ID            string      `json:"id"`
+	Kind          EmailKind   `json:"kind"`
+	OrderID       string      `json:"order_id"`
+	To            string      `json:"to"`
+	Subject       string      `json:"subject"`
+	Body          string      `json:"body"`
+	Status        EmailStatus `json:"status"`
+	Attempts      int         `json:"attempts"`
+	LastError     string      `json:"last_error,omitempty"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	CreatedAt     time.Time   `json:"created_at"`
+	SentAt        time.Time   `json:"sent_at"`
+}
+
+// newOrderEmail renders an email of the given kind about the order.
+func newOrderEmail(kind EmailKind, o *Order, now time.Time) (*Email, error) {
+	tmpl, ok := emailTemplates[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown email kind %q", kind)
+	}
+	data := struct{ Order *Order }{Order: o}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, err
+	}
+	return &Email{
+		ID:            string(kind) + ":" + o.ID,
+		Kind:          kind,
+		OrderID:       o.ID,
+		To:            o.UserEmail,
+		Subject:       strings.TrimSpace(subject.String()),
+		Body:          strings.TrimLeft(body.String(), "\n"),
+		Status:        EmailStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+// queueOrderEmail puts an email about the order in the outbox. Orders
+// without an email address and emails that were already queued are
+// skipped. Failures are logged rather than returned since the order
+// itself has already been saved.
+func (s *Server) queueOrderEmail(ctx context.Context, kind EmailKind, o *Order) {
+	if o.UserEmail == "" {
+		return
+	}
+	email, err := newOrderEmail(kind, o, s.Clock.Now())
+	if err == nil {
+		err = s.Store.EnqueueEmail(ctx, email)
+	}
+	if err != nil && !errors.Is(err, ErrEmailExists) {
+		log.Printf("queue %s email for order %s error: %v", kind, o.ID, err)
+	}
+}
+
+const (
+	// emailBatchSize is how many emails a dispatcher claims per pass and
+	// emailSendTimeout how long sending one may take. emailLease covers
+	// a batch of sends that all time out plus a margin, so emails are not
+	// claimed again while the batch is still being sent.
+	emailBatchSize   = 10
+	emailSendTimeout = 15 * time.Second
+	emailLease       = emailBatchSize*emailSendTimeout + time.Minute
+)
+
+// MailDispatcher sends the emails waiting in the outbox, retrying failures
+// with exponential backoff, and queues reminders for pending orders that
+// expire within ReminderBefore.
+type MailDispatcher struct {
+	Store          Store
+	Mailer         Mailer
+	Clock          Clock
+	Interval       time.Duration
+	MaxAttempts    int
+	ReminderBefore time.Duration
+}
+
+// Run sends due emails every Interval until ctx is cancelled.
+func (d *MailDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.RemindOnce(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("queue expiry reminders error: %v", err)
+			}
+			if _, err := d.SendOnce(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("send emails error: %v", err)
+			}
+		}
+	}
+}
+
+// RemindOnce queues an expiry reminder for every pending order that
+// expires within ReminderBefore.
+func (d *MailDispatcher) RemindOnce(ctx context.Context) error {
+	now := d.Clock.Now()
+	orders, err := d.Store.ListOrders(ctx, OrderFilter{
+		Status:        OrderStatusPending,
+		ExpiresBefore: now.Add(d.ReminderBefore),
+	})
+	if err != nil {
+		return err
+	}
+	for _, o := range orders {
+		if o.UserEmail == "" || o.IsExpired(now) {
+			continue
+		}
+		email, err := newOrderEmail(EmailExpiryReminder, &o, now)
+		if err != nil {
+			return err
+		}
+		if err := d.Store.EnqueueEmail(ctx, email); err != nil && !errors.Is(err, ErrEmailExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendOnce claims the emails that are due, tries to send each of them
+// once and returns how many it tried.
+func (d *MailDispatcher) SendOnce(ctx context.Context) (int, error) {
+	emails, err := d.Store.ClaimEmails(ctx, d.Clock.Now(), emailLease, emailBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, email := range emails {
+		sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+		sendErr := d.Mailer.Send(sendCtx, &Message{To: email.To, Subject: email.Subject, Body: email.Body})
+		cancel()
+
+		now := d.Clock.Now()
+		attempts := email.Attempts + 1
+		switch {
+		case sendErr == nil:
+			err = d.Store.RecordEmailAttempt(ctx, email.ID, attempts, "", EmailStatusSent, now)
+		case attempts >= d.MaxAttempts:
+			log.Printf("email %s to %s failed for good: %v", email.ID, email.To, sendErr)
+			err = d.Store.RecordEmailAttempt(ctx, email.ID, attempts, sendErr.Error(), EmailStatusFailed, now)
+		default:
+			log.Printf("email %s to %s failed (attempt %d): %v", email.ID, email.To, attempts, sendErr)
+			err = d.Store.RecordEmailAttempt(ctx, email.ID, attempts, sendErr.Error(), EmailStatusPending, now.Add(retryBackoff(attempts)))
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(emails), nil
+}
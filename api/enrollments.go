@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type EnrollmentStatus string
+
+const (
+	EnrollmentStatusActive  EnrollmentStatus = "active"
+	EnrollmentStatusRevoked EnrollmentStatus = "revoked"
+)
+
+// Enrollment grants a buyer access to a course. It is created when the
+// order is paid and revoked when the order is refunded. Seats is the
+// quantity bought on the order's line item.
+type Enrollment struct {
+	UserEmail string           `json:"user_email"`
+	Course    string           `json:"course"`
+	OrderID   string           `json:"order_id"`
+	Seats     int              `json:"seats"`
+	Status    EnrollmentStatus `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
+	RevokedAt time.Time        `json:"revoked_at"`
+}
+
+// normalizeEmail makes enrollment lookups case-insensitive.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// enrollmentsForOrder returns an active enrollment for every line item of
+// the paid order.
+func enrollmentsForOrder(o *Order) []Enrollment {
+	items := o.Items
+	if len(items) == 0 {
+		items = []OrderItem{{Course: o.Course, Quantity: 1}}
+	}
+	enrollments := make([]Enrollment, 0, len(items))
+	for _, item := range items {
+		enrollments = append(enrollments, Enrollment{
+			UserEmail: normalizeEmail(o.UserEmail),
+			Course:    item.Course,
+			OrderID:   o.ID,
+			Seats:     item.Quantity,
+			Status:    EnrollmentStatusActive,
+			CreatedAt: o.PaidAt,
+		})
+	}
+	return enrollments
+}
+
+// ListUserEnrollmentsHandler lists the enrollments of a user. Only active
+// enrollments are returned unless status is given.
+func (s *Server) ListUserEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.listEnrollments(w, r, EnrollmentFilter{UserEmail: normalizeEmail(vars["email"])})
+}
+
+// ListCourseEnrollmentsHandler lists the enrollments in a course. Only
+// active enrollments are returned unless status is given.
+func (s *Server) ListCourseEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.listEnrollments(w, r, EnrollmentFilter{Course: vars["course"]})
+}
+
+func (s *Server) listEnrollments(w http.ResponseWriter, r *http.Request, filter EnrollmentFilter) {
+	w.Header().Set("Content-Type", "application/json")
+
+	filter.Status = EnrollmentStatusActive
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter.Status = EnrollmentStatus(status)
+		if filter.Status != EnrollmentStatusActive && filter.Status != EnrollmentStatusRevoked {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid status")
+			return
+		}
+	}
+
+	enrollments, err := s.Store.ListEnrollments(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading enrollments")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(map[string]interface{}{"enrollments": enrollments})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
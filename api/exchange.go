@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+var (
+	ErrCurrencyNotSupported = errors.New("currency not supported")
+	ErrInvalidExchangeRates = errors.New("invalid exchange rates")
+)
+
+// ExchangeRates converts between currencies. Rates are how many units of
+// a currency one unit of Base buys.
+type ExchangeRates struct {
+	Base  string             `json:"base" yaml:"base"`
+	Rates map[string]float64 `json:"rates" yaml:"rates"`
+}
+
+// LoadExchangeRates reads and validates an exchange-rate file.
+func LoadExchangeRates(path string) (*ExchangeRates, error) {
+	var rates ExchangeRates
+	if err := decodeConfigFile(path, &rates); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidExchangeRates, err)
+	}
+
+	if !isCurrencyCode(rates.Base) {
+		return nil, fmt.Errorf("%w %s: base %q is not an ISO 4217 currency code", ErrInvalidExchangeRates, path, rates.Base)
+	}
+	for code, rate := range rates.Rates {
+		if !isCurrencyCode(code) || rate <= 0 {
+			return nil, fmt.Errorf("%w %s: rate for %q must be a positive number for an ISO 4217 currency", ErrInvalidExchangeRates, path, code)
+		}
+	}
+	if rates.Rates == nil {
+		rates.Rates = map[string]float64{}
+	}
+	rates.Rates[rates.Base] = 1
+	return &rates, nil
+}
+
+// Convert converts amount between currencies through the base currency.
+// The result is rounded to the minor unit of the target currency.
+func (x *ExchangeRates) Convert(amount float64, from, to string) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	if x == nil {
+		return 0, ErrCurrencyNotSupported
+	}
+	fromRate, ok := x.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: no exchange rate for %s", ErrCurrencyNotSupported, from)
+	}
+	toRate, ok := x.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: no exchange rate for %s", ErrCurrencyNotSupported, to)
+	}
+	return roundCurrency(amount/fromRate*toRate, to), nil
+}
+
+// PriceIn returns the course price in the given currency: the explicit
+// price list entry when there is one, otherwise the base price converted
+// with the exchange rates.
+func (c *Course) PriceIn(currency string, rates *ExchangeRates) (float64, error) {
+	if p, ok := c.Prices[currency]; ok {
+		return p, nil
+	}
+	return rates.Convert(c.Price, c.Currency, currency)
+}
+
+// exchangeRates returns the currently loaded exchange rates, which may be
+// nil when no rate file is configured.
+func (s *Server) exchangeRates() *ExchangeRates {
+	s.ratesMu.RLock()
+	defer s.ratesMu.RUnlock()
+	return s.rates
+}
+
+// ReloadExchangeRates replaces the exchange rates with the content of the
+// configured file. The current rates are kept when the file is invalid.
+func (s *Server) ReloadExchangeRates(ctx context.Context) error {
+	if s.Config.ExchangeRatesPath == "" {
+		return nil
+	}
+	rates, err := LoadExchangeRates(s.Config.ExchangeRatesPath)
+	if err != nil {
+		return err
+	}
+
+	s.ratesMu.Lock()
+	s.rates = rates
+	s.ratesMu.Unlock()
+
+	log.Printf("loaded %d exchange rates from %s", len(rates.Rates), s.Config.ExchangeRatesPath)
+	return nil
+}
+
+func (s *Server) ReloadExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := s.ReloadExchangeRates(r.Context())
+	if errors.Is(err, ErrInvalidExchangeRates) {
+		writeError(w, http.StatusUnprocessableEntity, CodeExchangeRatesInvalid, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error loading exchange rates")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
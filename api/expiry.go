@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Clock abstracts time.Now so time-dependent code can be driven by a fake
+// clock in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ExpiryWorker periodically marks pending orders whose payment window has
+// elapsed as expired.
+type ExpiryWorker struct {
+	Store    OrderStore
+	Clock    Clock
+	Interval time.Duration
+}
+
+// Run expires orders every Interval until ctx is cancelled.
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.ExpireOnce(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("expire orders error: %v", err)
+			}
+		}
+	}
+}
+
+// ExpireOnce runs a single expiry pass using the worker's clock and
+// returns the orders it expired.
+func (w *ExpiryWorker) ExpireOnce(ctx context.Context) ([]Order, error) {
+	orders, err := w.Store.ExpireOrders(ctx, w.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		log.Printf("order %s expired", o.ID)
+	}
+	return orders, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock tests move by hand.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestExpiryWorkerExpireOnce(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	worker := &ExpiryWorker{Store: store, Clock: clock, Interval: time.Minute}
+
+	orders := []*Order{
+		{ID: "soon", Status: OrderStatusPending, ExpiresAt: clock.Now().Add(10 * time.Minute)},
+		{ID: "later", Status: OrderStatusPending, ExpiresAt: clock.Now().Add(30 * time.Minute)},
+		{ID: "no-expiry", Status: OrderStatusPending},
+		{ID: "paid", Status: OrderStatusPaid, ExpiresAt: clock.Now().Add(10 * time.Minute)},
+	}
+	for _, o := range orders {
+		o.CreatedAt = clock.Now()
+		if err := store.CreateOrder(ctx, o); err != nil {
+			t.Fatalf("CreateOrder(%s): %v", o.ID, err)
+		}
+	}
+
+	steps := []struct {
+		advance time.Duration
+		want    []string
+	}{
+		{advance: 0, want: nil},
+		{advance: 9 * time.Minute, want: nil},
+		// The payment window ends exactly at ExpiresAt.
+		{advance: time.Minute, want: []string{"soon"}},
+		{advance: time.Minute, want: nil},
+		{advance: time.Hour, want: []string{"later"}},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		expired, err := worker.ExpireOnce(ctx)
+		if err != nil {
+			t.Fatalf("step %d: ExpireOnce: %v", i, err)
+		}
+		if got := orderIDs(expired); !slices.Equal(got, step.want) {
+			t.Errorf("step %d: expired %v, want %v", i, got, step.want)
+		}
+	}
+
+	wantStatus := map[string]OrderStatus{
+		"soon":      OrderStatusExpired,
+		"later":     OrderStatusExpired,
+		"no-expiry": OrderStatusPending,
+		"paid":      OrderStatusPaid,
+	}
+	for id, want := range wantStatus {
+		o, err := store.GetOrder(ctx, id)
+		if err != nil {
+			t.Fatalf("GetOrder(%s): %v", id, err)
+		}
+		if o.Status != want {
+			t.Errorf("order %s status = %s, want %s", id, o.Status, want)
+		}
+	}
+
+	soon, _ := store.GetOrder(ctx, "soon")
+	if want := orders[0].ExpiresAt; !soon.ExpiredAt.Equal(want) {
+		t.Errorf("soon expired_at = %v, want %v", soon.ExpiredAt, want)
+	}
+}
+
+func TestExpiryWorkerRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	clock := newFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	order := &Order{ID: "order", Status: OrderStatusPending, CreatedAt: clock.Now(), ExpiresAt: clock.Now()}
+	if err := store.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	worker := &ExpiryWorker{Store: store, Clock: clock, Interval: time.Millisecond}
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		o, err := store.GetOrder(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		if o.Status == OrderStatusExpired {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("worker did not expire the order")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func orderIDs(orders []Order) []string {
+	var ids []string
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	return ids
+}
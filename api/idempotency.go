@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	ErrIdempotencyRecordNotFound = errors.New("idempotency record not found")
+	ErrIdempotencyKeyExists      = errors.New("idempotency key already exists")
+)
+
+// IdempotencyRecord remembers the response of the first request made with
+// an Idempotency-Key so retries can be answered with the same response.
+// A record with a zero StatusCode is still being processed.
+type IdempotencyRecord struct {
+	Scope       string    `db:"scope"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"`
+	Body        []byte    `db:"body"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// responseRecorder captures the status code and body written by a handler
+// while passing them through to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent wraps a handler so requests carrying an Idempotency-Key header
+// are executed at most once per key. Repeats with the same body get the
+// stored response replayed, repeats with a different body get 422 and
+// repeats that arrive while the first request is still running get 409.
+// Responses with a 5xx status are not stored so the client can retry.
+// Keys can be used again once their response is older than the
+// IdempotencyTTL, or once the first request has been in progress for
+// longer than IdempotencyStaleAfter, e.g. because the process died.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		rec := &IdempotencyRecord{
+			Scope:       idempotencyScope(r),
+			Key:         key,
+			RequestHash: hex.EncodeToString(sum[:]),
+			CreatedAt:   s.Clock.Now(),
+		}
+
+		err = s.Store.CreateIdempotencyRecord(r.Context(), rec)
+		if errors.Is(err, ErrIdempotencyKeyExists) {
+			err = s.reclaimIdempotencyRecord(r.Context(), rec)
+		}
+		if errors.Is(err, ErrIdempotencyKeyExists) {
+			s.replayIdempotentResponse(w, r, rec)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving idempotency key")
+			return
+		}
+
+		rw := &responseRecorder{ResponseWriter: w}
+		next(rw, r)
+
+		if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+			if err := s.Store.DeleteIdempotencyRecord(r.Context(), rec.Scope, rec.Key); err != nil {
+				log.Printf("delete idempotency record %q error: %v", rec.Key, err)
+			}
+			return
+		}
+		if err := s.Store.CompleteIdempotencyRecord(r.Context(), rec.Scope, rec.Key, rw.status, rw.body.Bytes()); err != nil {
+			log.Printf("complete idempotency record %q error: %v", rec.Key, err)
+		}
+	}
+}
+
+// idempotencyScope is the namespace of the request's Idempotency-Key. It
+// includes the API key, so clients that happen to pick the same key never
+// get each other's responses replayed.
+func idempotencyScope(r *http.Request) string {
+	scope := r.Method + " " + r.URL.Path
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		scope = key.ID + " " + scope
+	}
+	return scope
+}
+
+// reclaimIdempotencyRecord takes over the key of rec when the record
+// holding it has expired or was abandoned. It returns
+// ErrIdempotencyKeyExists when the record is still live.
+func (s *Server) reclaimIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord) error {
+	existing, err := s.Store.GetIdempotencyRecord(ctx, rec.Scope, rec.Key)
+	if errors.Is(err, ErrIdempotencyRecordNotFound) {
+		return ErrIdempotencyKeyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	maxAge := s.Config.IdempotencyTTL
+	if existing.StatusCode == 0 {
+		maxAge = s.Config.IdempotencyStaleAfter
+	}
+	if rec.CreatedAt.Sub(existing.CreatedAt) < maxAge {
+		return ErrIdempotencyKeyExists
+	}
+	if existing.StatusCode == 0 {
+		log.Printf("reclaiming idempotency key %q abandoned since %s", rec.Key, existing.CreatedAt.Format(time.RFC3339))
+	}
+	return s.Store.ReclaimIdempotencyRecord(ctx, rec, existing.CreatedAt)
+}
+
+func (s *Server) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, rec *IdempotencyRecord) {
+	existing, err := s.Store.GetIdempotencyRecord(r.Context(), rec.Scope, rec.Key)
+	if errors.Is(err, ErrIdempotencyRecordNotFound) {
+		// The first request failed and released the key in the meantime.
+		writeError(w, http.StatusConflict, CodeIdempotencyPending, "Request with this Idempotency-Key is being retried, try again")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading idempotency key")
+		return
+	}
+	if existing.RequestHash != rec.RequestHash {
+		writeError(w, http.StatusUnprocessableEntity, CodeIdempotencyReused, "Idempotency-Key was already used with a different request body")
+		return
+	}
+	if existing.StatusCode == 0 {
+		writeError(w, http.StatusConflict, CodeIdempotencyPending, "Request with this Idempotency-Key is still in progress")
+		return
+	}
+
+	if existing.StatusCode >= http.StatusBadRequest {
+		w.Header().Set("Content-Type", problemContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.Body)
+}
+
+// IdempotencyPruner periodically forgets idempotency records older than
+// TTL.
+type IdempotencyPruner struct {
+	Store    IdempotencyStore
+	Clock    Clock
+	TTL      time.Duration
+	Interval time.Duration
+}
+
+// Run prunes records every Interval until ctx is cancelled.
+func (p *IdempotencyPruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := p.Clock.Now().Add(-p.TTL)
+			if err := p.Store.DeleteIdempotencyRecords(ctx, before); err != nil && ctx.Err() == nil {
+				log.Printf("prune idempotency records error: %v", err)
+			}
+		}
+	}
+}
@@ -1,265 +1,351 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type Course struct {
-	Name        string  `json:"name"`
-	DisplayName string  `json:"display_name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Currency    string  `json:"currency"`
+	Name        string  `json:"name" yaml:"name" db:"name"`
+	DisplayName string  `json:"display_name" yaml:"display_name" db:"display_name"`
+	Description string  `json:"description" yaml:"description" db:"description"`
+	Price       float64 `json:"price" yaml:"price" db:"price"`
+	Currency    string  `json:"currency" yaml:"currency" db:"currency"`
+	Archived    bool    `json:"archived" yaml:"archived" db:"archived"`
+
+	// Prices holds explicit prices in other currencies. Currencies
+	// without an entry are converted from Price using the exchange rates.
+	Prices PriceList `json:"prices,omitempty" yaml:"prices,omitempty" db:"prices"`
 }
 
 type Order struct {
-	ID        string    `json:"id"`
-	Course    string    `json:"course"`
-	Price     float64   `json:"price"`
-	Currency  string    `json:"currency"`
-	UserEmail string    `json:"user_email"`
-	UserName  string    `json:"user_name"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	PaidAt    time.Time `json:"paid_at"`
+	ID          string      `json:"id"`
+	Course      string      `json:"course"`
+	Price       float64     `json:"price"`
+	Currency    string      `json:"currency"`
+	UserEmail   string      `json:"user_email"`
+	UserName    string      `json:"user_name"`
+	Status      OrderStatus `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	PaidAt      time.Time   `json:"paid_at"`
+	CancelledAt time.Time   `json:"cancelled_at"`
+	ExpiredAt   time.Time   `json:"expired_at"`
+	RefundedAt  time.Time   `json:"refunded_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+
+	PaymentSessionID string `json:"payment_session_id"`
+	PaymentURL       string `json:"payment_url"`
+
+	// OriginalPrice is the course price before any coupon. Price is what
+	// the buyer pays: OriginalPrice minus Discount, plus tax.
+	OriginalPrice float64 `json:"original_price"`
+	Discount      float64 `json:"discount"`
+	CouponCode    string  `json:"coupon_code,omitempty"`
+
+	// Country is the buyer's ISO 3166-1 alpha-2 country. Tax is charged
+	// on Subtotal (OriginalPrice minus Discount) at TaxRate, and Total,
+	// which equals Price, is Subtotal plus Tax.
+	Country  string  `json:"country"`
+	Subtotal float64 `json:"subtotal"`
+	TaxName  string  `json:"tax_name,omitempty"`
+	TaxRate  float64 `json:"tax_rate"`
+	Tax      float64 `json:"tax"`
+	Total    float64 `json:"total"`
+
+	// Items are the courses bought and their seat counts. Course is the
+	// first item's course, kept for single-course clients, and
+	// OriginalPrice is the sum of the item amounts.
+	Items OrderItems `json:"items"`
 }
 
-var coursesDB = map[string]Course{
-	"software-security": {
-		Name:        "software-security",
-		DisplayName: "Software Security",
-		Description: "Learn how to secure your software",
-		Price:       100.0,
-		Currency:    "USD",
-	},
+type Server struct {
+	Config   *Config
+	Store    Store
+	Clock    Clock
+	Payments PaymentProvider
+	Mailer   Mailer
+
+	// catalogMu serializes catalog reloads.
+	catalogMu sync.Mutex
+
+	// ratesMu guards the exchange-rate, tax and rate limit tables, which
+	// are replaced on reload.
+	ratesMu sync.RWMutex
+	rates   *ExchangeRates
+	taxes   *TaxTable
+	limits  *RateLimits
 }
 
-var ordersDB = map[string]Order{}
-
-type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-}
-
-func writeError(w http.ResponseWriter, code int, message string) {
-	errorResponse := Error{
-		Message: message,
-		Code:    code,
+// newStore picks the storage backend from COURSES_API_STORE. "postgres"
+// connects using the COURSES_API_DB_* variables and applies pending
+// migrations; anything else falls back to the in-memory store.
+func newStore(ctx context.Context) (Store, error) {
+	switch os.Getenv("COURSES_API_STORE") {
+	case "postgres":
+		db, err := NewSQLx()
+		if err != nil {
+			return nil, err
+		}
+		if err := db.PingContext(ctx); err != nil {
+			return nil, fmt.Errorf("connect to postgres: %w", err)
+		}
+		if err := Migrate(ctx, db); err != nil {
+			return nil, err
+		}
+		return NewPostgresStore(db), nil
+	default:
+		return NewMemoryStore(), nil
 	}
-	jsonError, _ := json.Marshal(errorResponse)
-	w.WriteHeader(code)
-	w.Write(jsonError)
 }
 
-func ListCoursesHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	courses := make([]Course, 0, len(coursesDB))
-	for _, course := range coursesDB {
-		courses = append(courses, course)
-	}
-
-	jsonResponse, err := json.Marshal(courses)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Error encoding JSON")
-		return
+// newPaymentProvider builds the gateway selected by
+// COURSES_API_PAYMENT_PROVIDER. Only the local mock provider exists today.
+func newPaymentProvider(cfg *Config) (PaymentProvider, error) {
+	switch cfg.PaymentProvider {
+	case "mock":
+		secret := []byte(cfg.PaymentWebhookSecret)
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+			log.Println("COURSES_API_PAYMENT_WEBHOOK_SECRET is not set, using a random secret")
+		}
+		return &MockPaymentProvider{
+			BaseURL:          cfg.BaseURL,
+			Secret:           secret,
+			OrderTokenSecret: []byte(cfg.OrderTokenSecret),
+			Clock:            systemClock{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
 }
 
-func GetCourseHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	courseName := vars["course"]
-
-	course, ok := coursesDB[courseName]
-	if !ok {
-		writeError(w, http.StatusNotFound, "Course not found")
-		return
+func (s *Server) Start(ctx context.Context) {
+	r := mux.NewRouter()
+	r.Use(s.authenticateRequests, s.rateLimit)
+
+	r.HandleFunc("/courses", s.requireScope(ScopeCoursesRead, s.ListCoursesHandler)).Methods("GET")
+	r.HandleFunc("/courses", s.requireScope(ScopeAdmin, s.CreateCourseHandler)).Methods("POST")
+	r.HandleFunc("/courses/{course}", s.requireScope(ScopeCoursesRead, s.GetCourseHandler)).Methods("GET")
+	r.HandleFunc("/courses/{course}", s.requireScope(ScopeAdmin, s.ReplaceCourseHandler)).Methods("PUT")
+	r.HandleFunc("/courses/{course}", s.requireScope(ScopeAdmin, s.UpdateCourseHandler)).Methods("PATCH")
+	r.HandleFunc("/courses/{course}", s.requireScope(ScopeAdmin, s.ArchiveCourseHandler)).Methods("DELETE")
+	r.HandleFunc("/courses/{course}/enrollments", s.requireScope(ScopeAdmin, s.ListCourseEnrollmentsHandler)).Methods("GET")
+	r.HandleFunc("/users/{email}/enrollments", s.requireScope(ScopeEnrollmentsRead, s.ListUserEnrollmentsHandler)).Methods("GET")
+	r.HandleFunc("/orders", s.requireScope(ScopeOrdersRead, s.ListOrdersHandler)).Methods("GET")
+	r.HandleFunc("/orders", s.requireScope(ScopeOrdersWrite, s.idempotent(s.CreateOrderHandler))).Methods("POST")
+	r.HandleFunc("/orders/{order}", s.requireScope(ScopeOrdersRead, s.GetOrderHandler)).Methods("GET")
+	r.HandleFunc("/carts", s.requireScope(ScopeOrdersWrite, s.CreateCartHandler)).Methods("POST")
+	r.HandleFunc("/carts/{cart}", s.requireScope(ScopeOrdersRead, s.GetCartHandler)).Methods("GET")
+	r.HandleFunc("/carts/{cart}", s.requireScope(ScopeOrdersWrite, s.ReplaceCartHandler)).Methods("PUT")
+	r.HandleFunc("/carts/{cart}:checkout", s.requireScope(ScopeOrdersWrite, s.idempotent(s.CheckoutCartHandler))).Methods("POST")
+	r.HandleFunc("/orders/{order}/payment", s.requireOrderToken(ScopeOrdersRead, s.OrderPaymentPageHandler)).Methods("GET")
+	r.HandleFunc("/orders/{order}:cancel", s.requireScope(ScopeOrdersWrite, s.CancelOrderHandler)).Methods("POST")
+	r.HandleFunc("/orders/{order}:refund", s.requireScope(ScopeAdmin, s.RefundOrderHandler)).Methods("POST")
+	r.HandleFunc("/webhooks/payments", s.PaymentWebhookHandler).Methods("POST")
+	r.HandleFunc("/admin/api-keys", s.requireScope(ScopeAdmin, s.ListAPIKeysHandler)).Methods("GET")
+	r.HandleFunc("/admin/api-keys", s.requireScope(ScopeAdmin, s.CreateAPIKeyHandler)).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{key}", s.requireScope(ScopeAdmin, s.RevokeAPIKeyHandler)).Methods("DELETE")
+	r.HandleFunc("/admin/catalog:reload", s.requireScope(ScopeAdmin, s.ReloadCatalogHandler)).Methods("POST")
+	r.HandleFunc("/admin/exchange-rates:reload", s.requireScope(ScopeAdmin, s.ReloadExchangeRatesHandler)).Methods("POST")
+	r.HandleFunc("/admin/tax-rates:reload", s.requireScope(ScopeAdmin, s.ReloadTaxTableHandler)).Methods("POST")
+	r.HandleFunc("/admin/webhooks", s.requireScope(ScopeAdmin, s.ListWebhooksHandler)).Methods("GET")
+	r.HandleFunc("/admin/webhooks", s.requireScope(ScopeAdmin, s.CreateWebhookHandler)).Methods("POST")
+	r.HandleFunc("/admin/webhooks/{webhook}", s.requireScope(ScopeAdmin, s.GetWebhookHandler)).Methods("GET")
+	r.HandleFunc("/admin/webhooks/{webhook}", s.requireScope(ScopeAdmin, s.DisableWebhookHandler)).Methods("DELETE")
+	r.HandleFunc("/admin/webhooks/{webhook}/deliveries", s.requireScope(ScopeAdmin, s.ListWebhookDeliveriesHandler)).Methods("GET")
+	r.HandleFunc("/coupons", s.requireScope(ScopeAdmin, s.ListCouponsHandler)).Methods("GET")
+	r.HandleFunc("/coupons", s.requireScope(ScopeAdmin, s.CreateCouponHandler)).Methods("POST")
+	r.HandleFunc("/coupons/{coupon}", s.requireScope(ScopeAdmin, s.GetCouponHandler)).Methods("GET")
+	r.HandleFunc("/coupons/{coupon}", s.requireScope(ScopeAdmin, s.DisableCouponHandler)).Methods("DELETE")
+	if _, ok := s.Payments.(*MockPaymentProvider); ok {
+		r.HandleFunc("/orders/{order}:pay", s.requireOrderToken(ScopeOrdersWrite, s.PayOrderHandler)).Methods("POST")
 	}
 
-	jsonResponse, err := json.Marshal(course)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Error encoding JSON")
-		return
+	server := &http.Server{
+		Addr:    ":8080",
+		Handler: r,
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
-}
-
-func CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Define Order struct
-	type CreateOrderRequest struct {
-		Course    string `json:"course"`
-		UserName  string `json:"user_name"`
-		UserEmail string `json:"user_email"`
+	var wg sync.WaitGroup
+	worker := &ExpiryWorker{
+		Store:    s.Store,
+		Clock:    s.Clock,
+		Interval: s.Config.ExpiryInterval,
 	}
-
-	// Parse request body
-	var newOrder CreateOrderRequest
-	err := json.NewDecoder(r.Body).Decode(&newOrder)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
-		return
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		worker.Run(ctx)
+	}()
+
+	dispatcher := &WebhookDispatcher{
+		Store:       s.Store,
+		Clock:       s.Clock,
+		Client:      &http.Client{Timeout: webhookTimeout},
+		Interval:    s.Config.WebhookInterval,
+		MaxAttempts: s.Config.WebhookMaxAttempts,
 	}
-
-	// Check if the course is valid
-	course, ok := coursesDB[newOrder.Course]
-	if !ok {
-		writeError(w, http.StatusNotFound, "Course not found")
-		return
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	mailDispatcher := &MailDispatcher{
+		Store:          s.Store,
+		Mailer:         s.Mailer,
+		Clock:          s.Clock,
+		Interval:       s.Config.MailInterval,
+		MaxAttempts:    s.Config.MailMaxAttempts,
+		ReminderBefore: s.Config.ReminderBefore,
 	}
-
-	order := Order{
-		ID:        uuid.New().String(),
-		Course:    newOrder.Course,
-		UserName:  newOrder.UserName,
-		UserEmail: newOrder.UserEmail,
-		Status:    "pending",
-		CreatedAt: time.Now(),
-		Price:     course.Price,
-		Currency:  course.Currency,
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mailDispatcher.Run(ctx)
+	}()
+
+	pruner := &RateLimitPruner{
+		Store:    s.Store,
+		Clock:    s.Clock,
+		Limits:   s.rateLimits,
+		Interval: time.Minute,
 	}
-
-	// Add new order to the map (assuming ordersDB is defined elsewhere)
-	ordersDB[order.ID] = order
-
-	// Create response with payment page URL
-	type CreateOrderResponse struct {
-		OrderID string `json:"order_id"`
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pruner.Run(ctx)
+	}()
+
+	idempotencyPruner := &IdempotencyPruner{
+		Store:    s.Store,
+		Clock:    s.Clock,
+		TTL:      s.Config.IdempotencyTTL,
+		Interval: time.Hour,
 	}
-
-	response := CreateOrderResponse{
-		OrderID: order.ID,
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		idempotencyPruner.Run(ctx)
+	}()
+
+	go func() {
+		fmt.Println("Server is starting on port 8080...")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("ListenAndServe error: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	log.Println("shutting down http server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("failed to shutdown http server gracefully: ", err)
 	}
+	wg.Wait()
+}
 
-	// Send response
-	jsonResponse, err := json.Marshal(response)
+func main() {
+	catalogPath := flag.String("catalog", "", "path to the YAML or JSON course catalog, overrides COURSES_API_CATALOG")
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		oscall := <-ch
+		log.Printf("system call: %+v", oscall)
+		cancel()
+	}()
+
+	cfg, err := LoadConfig()
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Error encoding JSON")
-		return
+		log.Fatal("load config error: ", err)
 	}
-
-	w.WriteHeader(http.StatusCreated)
-	w.Write(jsonResponse)
-}
-
-func GetOrderHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	orderID := vars["order"]
-
-	// Get order from database
-	order, ok := ordersDB[orderID]
-	if !ok {
-		writeError(w, http.StatusNotFound, "Order not found")
-		return
+	if *catalogPath != "" {
+		cfg.CatalogPath = *catalogPath
+	}
+	if cfg.OrderTokenSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal("generate order token secret error: ", err)
+		}
+		cfg.OrderTokenSecret = hex.EncodeToString(secret)
+		log.Println("COURSES_API_ORDER_TOKEN_SECRET is not set, using a random secret")
 	}
 
-	// Prepare JSON response
-	jsonResponse, err := json.Marshal(order)
+	store, err := newStore(ctx)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Error encoding JSON")
-		return
+		log.Fatal("create store error: ", err)
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
-}
 
-func PayOrderHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	orderID := vars["order"]
-
-	// Get order from database
-	order, ok := ordersDB[orderID]
-	if !ok {
-		writeError(w, http.StatusNotFound, "Order not found")
-		return
+	payments, err := newPaymentProvider(cfg)
+	if err != nil {
+		log.Fatal("create payment provider error: ", err)
 	}
 
-	// Update order status
-	order.Status = "paid"
-	order.PaidAt = time.Now()
-
-	// Update order in database
-	ordersDB[orderID] = order
-
-	// Prepare JSON response
-	jsonResponse, err := json.Marshal(order)
+	mailer, err := newMailer(cfg)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Error encoding JSON")
-		return
+		log.Fatal("create mailer error: ", err)
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
-}
 
-func OrderPaymentPageHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	orderID := vars["order"]
-
-	// Get order from database
-	order, ok := ordersDB[orderID]
-	if !ok {
-		http.Error(w, "Order not found", http.StatusNotFound)
-		return
+	s := &Server{
+		Config:   cfg,
+		Store:    store,
+		Clock:    systemClock{},
+		Payments: payments,
+		Mailer:   mailer,
 	}
 
-	// Create HTML content
-	html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Pay for Order %s</title>
-</head>
-<body>
-    <h1>Pay for Order %s</h1>
-    <p>Total Amount: $%.2f</p>
-    <form action="/orders/%s:pay" method="POST">
-        <input type="submit" value="Pay Now">
-    </form>
-</body>
-</html>
-`, orderID, orderID, order.Price, orderID)
-
-	// Set content type and write HTML
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(html))
-}
-
-func main() {
-	r := mux.NewRouter()
-
-	r.HandleFunc("/courses", ListCoursesHandler).Methods("GET")
-	r.HandleFunc("/courses/{course}", GetCourseHandler).Methods("GET")
-	r.HandleFunc("/orders", CreateOrderHandler).Methods("POST")
-	r.HandleFunc("/orders/{order}", GetOrderHandler).Methods("GET")
-	r.HandleFunc("/orders/{order}/payment", OrderPaymentPageHandler).Methods("GET")
-	r.HandleFunc("/orders/{order}:pay", PayOrderHandler).Methods("POST")
-
-	http.Handle("/", r)
-
-	fmt.Println("Server is starting on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal("ListenAndServe error: ", err)
+	if err := s.ReloadCatalog(ctx); err != nil {
+		log.Fatal("load catalog error: ", err)
+	}
+	if err := s.ReloadExchangeRates(ctx); err != nil {
+		log.Fatal("load exchange rates error: ", err)
 	}
+	if err := s.ReloadTaxTable(ctx); err != nil {
+		log.Fatal("load tax rates error: ", err)
+	}
+	if err := s.ReloadRateLimits(ctx); err != nil {
+		log.Fatal("load rate limits error: ", err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := s.ReloadCatalog(ctx); err != nil {
+				log.Printf("reload catalog error: %v", err)
+			}
+			if err := s.ReloadExchangeRates(ctx); err != nil {
+				log.Printf("reload exchange rates error: %v", err)
+			}
+			if err := s.ReloadTaxTable(ctx); err != nil {
+				log.Printf("reload tax rates error: %v", err)
+			}
+			if err := s.ReloadRateLimits(ctx); err != nil {
+				log.Printf("reload rate limits error: %v", err)
+			}
+		}
+	}()
+
+	s.Start(ctx)
 }
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		courses:     map[string]Course{},
+		orders:      map[string]Order{},
+		idempotency: map[string]IdempotencyRecord{},
+		coupons:     map[string]Coupon{},
+		carts:       map[string]Cart{},
+		enrollments: map[string]Enrollment{},
+		webhooks:    map[string]WebhookSubscription{},
+		deliveries:  map[string]WebhookDelivery{},
+		emails:      map[string]Email{},
+		apiKeys:     map[string]APIKey{},
+		buckets:     map[string]RateLimitBucket{},
+	}
+}
+
+// MemoryStore keeps everything in process memory. It is meant for local
+// development and tests; data is lost on restart.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	courses     map[string]Course
+	orders      map[string]Order
+	idempotency map[string]IdempotencyRecord
+	coupons     map[string]Coupon
+	carts       map[string]Cart
+	// enrollments are keyed by order id and course.
+	enrollments map[string]Enrollment
+	webhooks    map[string]WebhookSubscription
+	deliveries  map[string]WebhookDelivery
+	emails      map[string]Email
+	apiKeys     map[string]APIKey
+	buckets     map[string]RateLimitBucket
+}
+
+func (s *MemoryStore) ListCourses(ctx context.Context, filter CourseFilter) ([]Course, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	courses := make([]Course, 0, len(s.courses))
+	for _, c := range s.courses {
+		if c.Archived {
+			continue
+		}
+		if query != "" &&
+			!strings.Contains(strings.ToLower(c.DisplayName), query) &&
+			!strings.Contains(strings.ToLower(c.Description), query) {
+			continue
+		}
+		if filter.After != nil && !courseAfter(c, *filter.After, filter.OrderBy) {
+			continue
+		}
+		courses = append(courses, c)
+	}
+	sort.Slice(courses, func(i, j int) bool {
+		return courseAfter(courses[j], courseCursor{Price: courses[i].Price, Name: courses[i].Name}, filter.OrderBy)
+	})
+	if filter.Limit > 0 && len(courses) > filter.Limit {
+		courses = courses[:filter.Limit]
+	}
+	return courses, nil
+}
+
+// courseAfter reports whether c sorts after the cursor position in the
+// given order.
+func courseAfter(c Course, cur courseCursor, orderBy CourseOrder) bool {
+	less, greater := c.Name < cur.Name, c.Name > cur.Name
+	if (orderBy == CourseOrderPrice || orderBy == CourseOrderPriceDesc) && c.Price != cur.Price {
+		less, greater = c.Price < cur.Price, c.Price > cur.Price
+	}
+	if orderBy.Desc() {
+		return less
+	}
+	return greater
+}
+
+func (s *MemoryStore) GetCourse(ctx context.Context, name string) (*Course, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.courses[name]
+	if !ok {
+		return nil, ErrCourseNotFound
+	}
+	return &c, nil
+}
+
+func (s *MemoryStore) CreateCourse(ctx context.Context, course *Course) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.courses[course.Name]; ok {
+		return ErrCourseExists
+	}
+	c := *course
+	c.Prices = maps.Clone(course.Prices)
+	s.courses[course.Name] = c
+	return nil
+}
+
+func (s *MemoryStore) UpdateCourse(ctx context.Context, course *Course) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.courses[course.Name]; !ok {
+		return ErrCourseNotFound
+	}
+	c := *course
+	c.Prices = maps.Clone(course.Prices)
+	s.courses[course.Name] = c
+	return nil
+}
+
+func (s *MemoryStore) ArchiveCourse(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.courses[name]
+	if !ok {
+		return ErrCourseNotFound
+	}
+	c.Archived = true
+	s.courses[name] = c
+	return nil
+}
+
+func (s *MemoryStore) CreateOrder(ctx context.Context, order *Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createOrder(order)
+}
+
+// createOrder redeems the order's coupon and saves the order. The caller
+// must hold s.mu.
+func (s *MemoryStore) createOrder(order *Order) error {
+	if order.CouponCode != "" {
+		c, ok := s.coupons[order.CouponCode]
+		if !ok {
+			return ErrCouponNotFound
+		}
+		if c.MaxRedemptions > 0 && c.Redemptions >= c.MaxRedemptions {
+			return ErrCouponExhausted
+		}
+		c.Redemptions++
+		s.coupons[c.Code] = c
+	}
+	o := *order
+	o.Items = slices.Clone(order.Items)
+	s.orders[order.ID] = o
+	return s.enqueueWebhookEvent(WebhookEventOrderCreated, &o, o.CreatedAt)
+}
+
+// releaseCoupon gives back the coupon redemption of an order that was not
+// paid. The caller must hold s.mu.
+func (s *MemoryStore) releaseCoupon(order *Order) {
+	if order.CouponCode == "" || !order.Status.releasesCoupon() {
+		return
+	}
+	c, ok := s.coupons[order.CouponCode]
+	if !ok || c.Redemptions == 0 {
+		return
+	}
+	c.Redemptions--
+	s.coupons[c.Code] = c
+}
+
+func (s *MemoryStore) GetOrder(ctx context.Context, id string) (*Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return &o, nil
+}
+
+func (s *MemoryStore) ListOrders(ctx context.Context, filter OrderFilter) ([]Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := []Order{}
+	for _, o := range s.orders {
+		if filter.UserEmail != "" && o.UserEmail != filter.UserEmail {
+			continue
+		}
+		if filter.Status != "" && o.Status != filter.Status {
+			continue
+		}
+		if filter.Course != "" && !o.HasCourse(filter.Course) {
+			continue
+		}
+		if !filter.CreatedAfter.IsZero() && !o.CreatedAt.After(filter.CreatedAfter) {
+			continue
+		}
+		// Orders without an expiry never match, like NULL expires_at in
+		// Postgres.
+		if !filter.ExpiresBefore.IsZero() && (o.ExpiresAt.IsZero() || !o.ExpiresAt.Before(filter.ExpiresBefore)) {
+			continue
+		}
+		if filter.After != nil && !orderAfter(o, *filter.After) {
+			continue
+		}
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orderAfter(orders[j], orderCursor{CreatedAt: orders[i].CreatedAt, ID: orders[i].ID})
+	})
+	if filter.Limit > 0 && len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+	}
+	return orders, nil
+}
+
+// orderAfter reports whether o sorts after the cursor position.
+func orderAfter(o Order, c orderCursor) bool {
+	if !o.CreatedAt.Equal(c.CreatedAt) {
+		return o.CreatedAt.After(c.CreatedAt)
+	}
+	return o.ID > c.ID
+}
+
+func (s *MemoryStore) TransitionOrder(ctx context.Context, id string, to OrderStatus, at time.Time) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if err := o.Transition(to, at); err != nil {
+		return nil, err
+	}
+	s.orders[id] = o
+	s.syncEnrollments(&o)
+	s.releaseCoupon(&o)
+	if event, ok := orderStatusEvents[to]; ok {
+		if err := s.enqueueWebhookEvent(event, &o, at); err != nil {
+			return nil, err
+		}
+	}
+	return &o, nil
+}
+
+func (s *MemoryStore) ExpireOrders(ctx context.Context, now time.Time) ([]Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []Order
+	for id, o := range s.orders {
+		if o.Status != OrderStatusPending || !o.IsExpired(now) {
+			continue
+		}
+		if err := o.Transition(OrderStatusExpired, now); err != nil {
+			return nil, err
+		}
+		s.orders[id] = o
+		s.releaseCoupon(&o)
+		expired = append(expired, o)
+	}
+	return expired, nil
+}
+
+func idempotencyMapKey(scope, key string) string {
+	return scope + "\x00" + key
+}
+
+func (s *MemoryStore) CreateIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyMapKey(rec.Scope, rec.Key)
+	if _, ok := s.idempotency[k]; ok {
+		return ErrIdempotencyKeyExists
+	}
+	s.idempotency[k] = *rec
+	return nil
+}
+
+func (s *MemoryStore) GetIdempotencyRecord(ctx context.Context, scope, key string) (*IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.idempotency[idempotencyMapKey(scope, key)]
+	if !ok {
+		return nil, ErrIdempotencyRecordNotFound
+	}
+	return &rec, nil
+}
+
+func (s *MemoryStore) CompleteIdempotencyRecord(ctx context.Context, scope, key string, statusCode int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyMapKey(scope, key)
+	rec, ok := s.idempotency[k]
+	if !ok {
+		return ErrIdempotencyRecordNotFound
+	}
+	rec.StatusCode = statusCode
+	rec.Body = append([]byte(nil), body...)
+	s.idempotency[k] = rec
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdempotencyRecord(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotency, idempotencyMapKey(scope, key))
+	return nil
+}
+
+func (s *MemoryStore) ReclaimIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord, createdAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyMapKey(rec.Scope, rec.Key)
+	existing, ok := s.idempotency[k]
+	if !ok || !existing.CreatedAt.Equal(createdAt) {
+		return ErrIdempotencyKeyExists
+	}
+	s.idempotency[k] = *rec
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdempotencyRecords(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, rec := range s.idempotency {
+		if rec.CreatedAt.Before(before) {
+			delete(s.idempotency, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"slices"
+)
+
+func (s *MemoryStore) CreateCart(ctx context.Context, cart *Cart) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *cart
+	c.Items = slices.Clone(cart.Items)
+	s.carts[c.ID] = c
+	return nil
+}
+
+func (s *MemoryStore) GetCart(ctx context.Context, id string) (*Cart, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.carts[id]
+	if !ok {
+		return nil, ErrCartNotFound
+	}
+	c.Items = slices.Clone(c.Items)
+	return &c, nil
+}
+
+func (s *MemoryStore) UpdateCart(ctx context.Context, cart *Cart) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.carts[cart.ID]
+	if !ok {
+		return ErrCartNotFound
+	}
+	if current.OrderID != "" {
+		return ErrCartCheckedOut
+	}
+	c := *cart
+	c.Items = slices.Clone(cart.Items)
+	s.carts[c.ID] = c
+	return nil
+}
+
+func (s *MemoryStore) CheckoutCart(ctx context.Context, cartID string, order *Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.carts[cartID]
+	if !ok {
+		return ErrCartNotFound
+	}
+	if c.OrderID != "" {
+		return ErrCartCheckedOut
+	}
+	if err := s.createOrder(order); err != nil {
+		return err
+	}
+	c.OrderID = order.ID
+	c.UpdatedAt = order.CreatedAt
+	s.carts[cartID] = c
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+func (s *MemoryStore) CreateCoupon(ctx context.Context, coupon *Coupon) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.coupons[coupon.Code]; ok {
+		return ErrCouponExists
+	}
+	c := *coupon
+	c.Courses = append([]string{}, coupon.Courses...)
+	s.coupons[c.Code] = c
+	return nil
+}
+
+func (s *MemoryStore) GetCoupon(ctx context.Context, code string) (*Coupon, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.coupons[code]
+	if !ok {
+		return nil, ErrCouponNotFound
+	}
+	return &c, nil
+}
+
+func (s *MemoryStore) ListCoupons(ctx context.Context) ([]Coupon, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	coupons := make([]Coupon, 0, len(s.coupons))
+	for _, c := range s.coupons {
+		coupons = append(coupons, c)
+	}
+	sort.Slice(coupons, func(i, j int) bool {
+		return coupons[i].Code < coupons[j].Code
+	})
+	return coupons, nil
+}
+
+func (s *MemoryStore) DisableCoupon(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.coupons[code]
+	if !ok {
+		return ErrCouponNotFound
+	}
+	c.Disabled = true
+	s.coupons[code] = c
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) EnqueueEmail(ctx context.Context, email *Email) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.emails[email.ID]; ok {
+		return ErrEmailExists
+	}
+	s.emails[email.ID] = *email
+	return nil
+}
+
+func (s *MemoryStore) ClaimEmails(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Email, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Email
+	for _, e := range s.emails {
+		if e.Status == EmailStatusPending && !e.NextAttemptAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, e := range due {
+		e.NextAttemptAt = now.Add(lease)
+		s.emails[e.ID] = e
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) RecordEmailAttempt(ctx context.Context, id string, attempts int, lastError string, status EmailStatus, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.emails[id]
+	if !ok {
+		return nil
+	}
+	e.Attempts = attempts
+	e.LastError = lastError
+	e.Status = status
+	e.NextAttemptAt = time.Time{}
+	switch status {
+	case EmailStatusSent:
+		e.SentAt = at
+	case EmailStatusPending:
+		e.NextAttemptAt = at
+	}
+	s.emails[id] = e
+	return nil
+}
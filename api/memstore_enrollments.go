@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// syncEnrollments grants or revokes the enrollments of an order that has
+// just been paid or refunded. The caller must hold s.mu.
+func (s *MemoryStore) syncEnrollments(o *Order) {
+	switch o.Status {
+	case OrderStatusPaid:
+		for _, e := range enrollmentsForOrder(o) {
+			s.enrollments[e.OrderID+"/"+e.Course] = e
+		}
+	case OrderStatusRefunded:
+		for key, e := range s.enrollments {
+			if e.OrderID == o.ID && e.Status == EnrollmentStatusActive {
+				e.Status = EnrollmentStatusRevoked
+				e.RevokedAt = o.RefundedAt
+				s.enrollments[key] = e
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) ListEnrollments(ctx context.Context, filter EnrollmentFilter) ([]Enrollment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	enrollments := []Enrollment{}
+	for _, e := range s.enrollments {
+		if filter.UserEmail != "" && e.UserEmail != filter.UserEmail {
+			continue
+		}
+		if filter.Course != "" && e.Course != filter.Course {
+			continue
+		}
+		if filter.Status != "" && e.Status != filter.Status {
+			continue
+		}
+		enrollments = append(enrollments, e)
+	}
+	sort.Slice(enrollments, func(i, j int) bool {
+		a, b := enrollments[i], enrollments[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.Course != b.Course {
+			return a.Course < b.Course
+		}
+		return a.OrderID < b.OrderID
+	})
+	return enrollments, nil
+}
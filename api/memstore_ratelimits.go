@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func (s *MemoryStore) TakeRateLimitToken(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = RateLimitBucket{Tokens: float64(limit.Burst), UpdatedAt: now}
+	}
+	res := b.Take(limit, now)
+	s.buckets[key] = b
+	return &res, nil
+}
+
+func (s *MemoryStore) DeleteRateLimitBuckets(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.UpdatedAt.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// enqueueWebhookEvent queues a delivery of the event to every subscription
+// that wants it. The caller must hold s.mu.
+func (s *MemoryStore) enqueueWebhookEvent(t WebhookEventType, o *Order, at time.Time) error {
+	var eventID string
+	var payload []byte
+	for _, w := range s.webhooks {
+		if !w.Subscribes(t) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if eventID, payload, err = newOrderEvent(t, o, at); err != nil {
+				return err
+			}
+		}
+		d := WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: w.ID,
+			EventID:        eventID,
+			EventType:      t,
+			Payload:        payload,
+			Status:         WebhookDeliveryPending,
+			NextAttemptAt:  at,
+			CreatedAt:      at,
+			AttemptLog:     []WebhookAttempt{},
+		}
+		s.deliveries[d.ID] = d
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateWebhook(ctx context.Context, webhook *WebhookSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := *webhook
+	w.Events = slices.Clone(webhook.Events)
+	s.webhooks[w.ID] = w
+	return nil
+}
+
+func (s *MemoryStore) GetWebhook(ctx context.Context, id string) (*WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return &w, nil
+}
+
+func (s *MemoryStore) ListWebhooks(ctx context.Context) ([]WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]WebhookSubscription, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		webhooks = append(webhooks, w)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (s *MemoryStore) DisableWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.webhooks[id]
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	w.Disabled = true
+	s.webhooks[id] = w
+	return nil
+}
+
+func (s *MemoryStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == WebhookDeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		d := s.deliveries[due[i].ID]
+		d.NextAttemptAt = now.Add(lease)
+		s.deliveries[d.ID] = d
+		due[i].AttemptLog = slices.Clone(due[i].AttemptLog)
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) RecordWebhookAttempt(ctx context.Context, deliveryID string, attempt WebhookAttempt, status WebhookDeliveryStatus, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[deliveryID]
+	if !ok {
+		return nil
+	}
+	d.Attempts = attempt.Attempt
+	d.AttemptLog = append(slices.Clone(d.AttemptLog), attempt)
+	d.Status = status
+	d.NextAttemptAt = next
+	if status == WebhookDeliveryDelivered {
+		d.DeliveredAt = attempt.At
+	}
+	s.deliveries[deliveryID] = d
+	return nil
+}
+
+func (s *MemoryStore) ListWebhookDeliveries(ctx context.Context, subscriptionID string, limit int) ([]WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := []WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS courses (
+    name         TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    price        NUMERIC(12, 2) NOT NULL,
+    currency     CHAR(3) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         UUID PRIMARY KEY,
+    course     TEXT NOT NULL REFERENCES courses (name),
+    price      NUMERIC(12, 2) NOT NULL,
+    currency   CHAR(3) NOT NULL,
+    user_email TEXT NOT NULL,
+    user_name  TEXT NOT NULL,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    paid_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_email_idx ON orders (user_email);
+
+INSERT INTO courses (name, display_name, description, price, currency)
+VALUES ('software-security', 'Software Security', 'Learn how to secure your software', 100.00, 'USD')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,6 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS expired_at   TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS refunded_at  TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status);
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS payment_session_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS payment_url        TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE courses
+    ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false;
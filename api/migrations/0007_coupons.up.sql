@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS coupons (
+    code            TEXT PRIMARY KEY,
+    type            TEXT NOT NULL,
+    value           NUMERIC(12, 2) NOT NULL,
+    currency        TEXT NOT NULL DEFAULT '',
+    courses         TEXT[] NOT NULL DEFAULT '{}',
+    expires_at      TIMESTAMPTZ,
+    max_redemptions INTEGER NOT NULL DEFAULT 0,
+    redemptions     INTEGER NOT NULL DEFAULT 0,
+    disabled        BOOLEAN NOT NULL DEFAULT false,
+    created_at      TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS original_price NUMERIC(12, 2),
+    ADD COLUMN IF NOT EXISTS discount       NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS coupon_code    TEXT NOT NULL DEFAULT '';
+
+UPDATE orders SET original_price = price WHERE original_price IS NULL;
+
+ALTER TABLE orders ALTER COLUMN original_price SET NOT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE courses ADD COLUMN IF NOT EXISTS prices JSONB NOT NULL DEFAULT '{}';
+
+-- Some currencies, such as KWD and BHD, have three decimal places.
+ALTER TABLE courses ALTER COLUMN price TYPE NUMERIC(15, 3);
+ALTER TABLE coupons ALTER COLUMN value TYPE NUMERIC(15, 3);
+ALTER TABLE orders
+    ALTER COLUMN price          TYPE NUMERIC(15, 3),
+    ALTER COLUMN original_price TYPE NUMERIC(15, 3),
+    ALTER COLUMN discount       TYPE NUMERIC(15, 3);
@@ -0,0 +1,13 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS country  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS subtotal NUMERIC(15, 3),
+    ADD COLUMN IF NOT EXISTS tax_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax_rate NUMERIC(6, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax      NUMERIC(15, 3) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS total    NUMERIC(15, 3);
+
+UPDATE orders SET subtotal = price, total = price WHERE subtotal IS NULL;
+
+ALTER TABLE orders
+    ALTER COLUMN subtotal SET NOT NULL,
+    ALTER COLUMN total    SET NOT NULL;
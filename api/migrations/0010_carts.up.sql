@@ -0,0 +1,25 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS items JSONB NOT NULL DEFAULT '[]';
+
+UPDATE orders o
+SET items = jsonb_build_array(jsonb_build_object(
+        'course', o.course,
+        'display_name', COALESCE(c.display_name, ''),
+        'quantity', 1,
+        'unit_price', o.original_price,
+        'amount', o.original_price))
+FROM orders o2
+LEFT JOIN courses c ON c.name = o2.course
+WHERE o.id = o2.id AND o.items = '[]';
+
+CREATE INDEX IF NOT EXISTS orders_items_idx ON orders USING GIN (items jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS carts (
+    id          TEXT PRIMARY KEY,
+    items       JSONB NOT NULL DEFAULT '[]',
+    currency    TEXT NOT NULL DEFAULT '',
+    country     TEXT NOT NULL DEFAULT '',
+    coupon_code TEXT NOT NULL DEFAULT '',
+    order_id    TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL
+);
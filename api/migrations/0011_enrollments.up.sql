@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS enrollments (
+    order_id   UUID NOT NULL REFERENCES orders (id),
+    course     TEXT NOT NULL,
+    user_email TEXT NOT NULL,
+    seats      INTEGER NOT NULL DEFAULT 1,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    PRIMARY KEY (order_id, course)
+);
+
+CREATE INDEX IF NOT EXISTS enrollments_user_email_idx ON enrollments (user_email, created_at);
+CREATE INDEX IF NOT EXISTS enrollments_course_idx ON enrollments (course, created_at);
+
+-- Enroll the buyers of orders paid before enrollments existed.
+INSERT INTO enrollments (order_id, course, user_email, seats, status, created_at, revoked_at)
+SELECT o.id, item->>'course', lower(o.user_email), COALESCE((item->>'quantity')::int, 1),
+       CASE WHEN o.status = 'refunded' THEN 'revoked' ELSE 'active' END,
+       o.paid_at, o.refunded_at
+FROM orders o, jsonb_array_elements(o.items) AS item
+WHERE o.status IN ('paid', 'refunded') AND o.paid_at IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS emails (
+    id              TEXT PRIMARY KEY,
+    kind            TEXT NOT NULL,
+    order_id        TEXT NOT NULL,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    body            TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL,
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS emails_due_idx ON emails (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+var ErrCourseArchived = errors.New("course is archived")
+
+const (
+	// maxOrderItems and maxItemQuantity bound a single order.
+	maxOrderItems   = 20
+	maxItemQuantity = 100
+)
+
+// OrderItem is a line item: a course and the number of seats bought.
+type OrderItem struct {
+	Course      string `json:"course"`
+	DisplayName string `json:"display_name,omitempty"`
+	Quantity    int    `json:"quantity"`
+	// UnitPrice is the price of one seat in the order currency and
+	// Amount is UnitPrice times Quantity.
+	UnitPrice float64 `json:"unit_price,omitempty"`
+	Amount    float64 `json:"amount,omitempty"`
+}
+
+// OrderItems is stored as JSONB.
+type OrderItems []OrderItem
+
+func (items OrderItems) Value() (driver.Value, error) {
+	if items == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(items)
+}
+
+func (items *OrderItems) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*items = OrderItems{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into OrderItems", src)
+	}
+	return json.Unmarshal(b, items)
+}
+
+// HasCourse reports whether any line item of the order is for the course.
+func (o *Order) HasCourse(name string) bool {
+	for _, item := range o.Items {
+		if item.Course == name {
+			return true
+		}
+	}
+	return o.Course == name
+}
+
+// orderRequest is everything needed to price an order.
+type orderRequest struct {
+	Items      []OrderItem
+	UserName   string
+	UserEmail  string
+	Currency   string
+	Country    string
+	CouponCode string
+}
+
+// validate normalizes the request and returns one error per invalid
+// field, or nil when the request is valid to place as an order.
+func (req *orderRequest) validate() ValidationErrors {
+	errs := req.validateQuote()
+	req.UserEmail = strings.TrimSpace(req.UserEmail)
+	if req.UserEmail == "" {
+		errs.Add("user_email", "User email is required")
+	} else if addr, err := mail.ParseAddress(req.UserEmail); err != nil || addr.Address != req.UserEmail {
+		// Addresses with a display name parse too, but are not an email.
+		errs.Add("user_email", "User email must be a valid email address")
+	}
+	return errs
+}
+
+// validateQuote validates the fields needed to price the request, which
+// are all a cart has. Country may be empty, see quoteOrder.
+func (req *orderRequest) validateQuote() ValidationErrors {
+	req.Currency = strings.ToUpper(req.Currency)
+	req.Country = strings.ToUpper(req.Country)
+	req.CouponCode = normalizeCouponCode(req.CouponCode)
+
+	var errs ValidationErrors
+	if len(req.Items) == 0 {
+		errs.Add("items", "Order must contain at least one course")
+	}
+	if len(req.Items) > maxOrderItems {
+		errs.Add("items", fmt.Sprintf("Order must not contain more than %d courses", maxOrderItems))
+	}
+	seen := map[string]bool{}
+	for i := range req.Items {
+		item := &req.Items[i]
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		switch {
+		case item.Course == "":
+			errs.Add(fmt.Sprintf("items[%d].course", i), "Every item must name a course")
+		case seen[item.Course]:
+			errs.Add(fmt.Sprintf("items[%d].course", i), fmt.Sprintf("Course %s is listed more than once", item.Course))
+		}
+		if item.Quantity < 1 || item.Quantity > maxItemQuantity {
+			errs.Add(fmt.Sprintf("items[%d].quantity", i), fmt.Sprintf("Item quantity must be between 1 and %d", maxItemQuantity))
+		}
+		seen[item.Course] = true
+	}
+	if req.Currency != "" && !isCurrencyCode(req.Currency) {
+		errs.Add("currency", "Currency must be an ISO 4217 code")
+	}
+	if req.Country != "" && !countryCodePattern.MatchString(req.Country) {
+		errs.Add("country", "Country must be a two letter ISO 3166 code")
+	}
+	return errs
+}
+
+// quoteOrder prices a validated request into a new pending order without
+// storing it. The currency defaults to the currency of the first course
+// and the country to the configured default country; without either the
+// order is not taxed.
+func (s *Server) quoteOrder(ctx context.Context, req orderRequest) (*Order, error) {
+	courses := make([]*Course, len(req.Items))
+	for i, item := range req.Items {
+		course, err := s.Store.GetCourse(ctx, item.Course)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", item.Course, err)
+		}
+		if course.Archived {
+			return nil, fmt.Errorf("%s: %w", item.Course, ErrCourseArchived)
+		}
+		courses[i] = course
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = courses[0].Currency
+	}
+
+	now := s.Clock.Now()
+	order := &Order{
+		Course:    req.Items[0].Course,
+		UserName:  req.UserName,
+		UserEmail: req.UserEmail,
+		Status:    OrderStatusPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.Config.PaymentWindow),
+		Currency:  currency,
+		Items:     make([]OrderItem, len(req.Items)),
+	}
+
+	rates := s.exchangeRates()
+	for i, item := range req.Items {
+		unitPrice, err := courses[i].PriceIn(currency, rates)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", item.Course, err)
+		}
+		order.Items[i] = OrderItem{
+			Course:      item.Course,
+			DisplayName: courses[i].DisplayName,
+			Quantity:    item.Quantity,
+			UnitPrice:   unitPrice,
+			Amount:      roundCurrency(unitPrice*float64(item.Quantity), currency),
+		}
+		order.OriginalPrice = roundCurrency(order.OriginalPrice+order.Items[i].Amount, currency)
+	}
+
+	if req.CouponCode != "" {
+		coupon, err := s.Store.GetCoupon(ctx, req.CouponCode)
+		if err != nil {
+			return nil, err
+		}
+		discount, err := coupon.Discount(order.Items, currency, now)
+		if err != nil {
+			return nil, err
+		}
+		order.CouponCode = req.CouponCode
+		order.Discount = discount
+	}
+
+	country := req.Country
+	if country == "" {
+		country = s.Config.DefaultCountry
+	}
+	order.ApplyTax(country, s.taxTable())
+	return order, nil
+}
+
+// writeOrderError explains why an order could not be priced or placed.
+func writeOrderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCourseNotFound):
+		writeError(w, http.StatusNotFound, CodeCourseNotFound, "Course not found")
+	case errors.Is(err, ErrCourseArchived):
+		writeError(w, http.StatusConflict, CodeCourseArchived, "Course is no longer available")
+	case errors.Is(err, ErrCurrencyNotSupported):
+		writeError(w, http.StatusUnprocessableEntity, CodeCurrencyNotSupported, "Course is not sold in this currency")
+	case errors.Is(err, ErrCouponNotFound), errors.Is(err, ErrCouponExpired),
+		errors.Is(err, ErrCouponExhausted), errors.Is(err, ErrCouponNotApplicable):
+		writeCouponError(w, err)
+	default:
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error creating order")
+	}
+}
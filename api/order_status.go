@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusExpired   OrderStatus = "expired"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+var (
+	ErrInvalidOrderTransition = errors.New("invalid order status transition")
+	ErrOrderExpired           = errors.New("order payment window has expired")
+)
+
+// orderTransitions lists, for every status, the statuses an order may move
+// to next. Statuses without an entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending: {OrderStatusPaid, OrderStatusCancelled, OrderStatusExpired},
+	OrderStatusPaid:    {OrderStatusRefunded},
+}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusCancelled, OrderStatusExpired, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// releasesCoupon reports whether an order entering the status gives back
+// its coupon redemption. Those orders were never paid, so the coupon was
+// not really used.
+func (s OrderStatus) releasesCoupon() bool {
+	return s == OrderStatusCancelled || s == OrderStatusExpired
+}
+
+// TransitionError reports a status change the order does not allow. It
+// matches ErrInvalidOrderTransition.
+type TransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%v: order is %s and cannot become %s", ErrInvalidOrderTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidOrderTransition
+}
+
+// Transition moves the order to the given status and stamps the matching
+// timestamp. It returns a *TransitionError when the move is not allowed
+// from the current status.
+func (o *Order) Transition(to OrderStatus, at time.Time) error {
+	if !o.Status.CanTransitionTo(to) {
+		return &TransitionError{From: o.Status, To: to}
+	}
+	if to == OrderStatusPaid && o.IsExpired(at) {
+		return ErrOrderExpired
+	}
+
+	o.Status = to
+	switch to {
+	case OrderStatusPaid:
+		o.PaidAt = at
+	case OrderStatusCancelled:
+		o.CancelledAt = at
+	case OrderStatusExpired:
+		o.ExpiredAt = at
+	case OrderStatusRefunded:
+		o.RefundedAt = at
+	}
+	return nil
+}
+
+// IsExpired reports whether the order can no longer be paid at the given
+// time, either because it was already marked expired or because its
+// payment window has elapsed and the expiry worker has not caught up yet.
+func (o *Order) IsExpired(now time.Time) bool {
+	if o.Status == OrderStatusExpired {
+		return true
+	}
+	return o.Status == OrderStatusPending && !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOrderTransition(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		from      OrderStatus
+		to        OrderStatus
+		expiresAt time.Time
+		wantErr   error
+	}{
+		{name: "pay pending", from: OrderStatusPending, to: OrderStatusPaid},
+		{name: "cancel pending", from: OrderStatusPending, to: OrderStatusCancelled},
+		{name: "expire pending", from: OrderStatusPending, to: OrderStatusExpired},
+		{name: "refund paid", from: OrderStatusPaid, to: OrderStatusRefunded},
+		{name: "pay within window", from: OrderStatusPending, to: OrderStatusPaid, expiresAt: now.Add(time.Minute)},
+		{name: "pay after window", from: OrderStatusPending, to: OrderStatusPaid, expiresAt: now, wantErr: ErrOrderExpired},
+		{name: "refund pending", from: OrderStatusPending, to: OrderStatusRefunded, wantErr: ErrInvalidOrderTransition},
+		{name: "pay paid", from: OrderStatusPaid, to: OrderStatusPaid, wantErr: ErrInvalidOrderTransition},
+		{name: "cancel paid", from: OrderStatusPaid, to: OrderStatusCancelled, wantErr: ErrInvalidOrderTransition},
+		{name: "pay cancelled", from: OrderStatusCancelled, to: OrderStatusPaid, wantErr: ErrInvalidOrderTransition},
+		{name: "pay expired", from: OrderStatusExpired, to: OrderStatusPaid, wantErr: ErrInvalidOrderTransition},
+		{name: "cancel refunded", from: OrderStatusRefunded, to: OrderStatusCancelled, wantErr: ErrInvalidOrderTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Order{ID: "order", Status: tt.from, ExpiresAt: tt.expiresAt}
+			err := o.Transition(tt.to, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transition(%s) error = %v, want %v", tt.to, err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if o.Status != tt.from {
+					t.Errorf("status = %s after failed transition, want %s", o.Status, tt.from)
+				}
+				return
+			}
+			if o.Status != tt.to {
+				t.Errorf("status = %s, want %s", o.Status, tt.to)
+			}
+			if got := orderStatusTime(o, tt.to); !got.Equal(now) {
+				t.Errorf("%s timestamp = %v, want %v", tt.to, got, now)
+			}
+		})
+	}
+}
+
+func TestOrderTransitionErrorMatches(t *testing.T) {
+	o := &Order{Status: OrderStatusCancelled}
+	err := o.Transition(OrderStatusPaid, time.Now())
+
+	var terr *TransitionError
+	if !errors.As(err, &terr) {
+		t.Fatalf("error = %v, want a *TransitionError", err)
+	}
+	if terr.From != OrderStatusCancelled || terr.To != OrderStatusPaid {
+		t.Errorf("TransitionError = %+v, want cancelled to paid", terr)
+	}
+}
+
+func TestMemoryStoreTransitionOrder(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		steps   []OrderStatus
+		want    OrderStatus
+		wantErr error
+	}{
+		{name: "pay then refund", steps: []OrderStatus{OrderStatusPaid, OrderStatusRefunded}, want: OrderStatusRefunded},
+		{name: "cancel", steps: []OrderStatus{OrderStatusCancelled}, want: OrderStatusCancelled},
+		{name: "pay twice", steps: []OrderStatus{OrderStatusPaid, OrderStatusPaid}, want: OrderStatusPaid, wantErr: ErrInvalidOrderTransition},
+		{name: "pay after cancel", steps: []OrderStatus{OrderStatusCancelled, OrderStatusPaid}, want: OrderStatusCancelled, wantErr: ErrInvalidOrderTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			order := &Order{ID: "order", Status: OrderStatusPending, CreatedAt: now}
+			if err := store.CreateOrder(ctx, order); err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+
+			var err error
+			for _, to := range tt.steps {
+				if _, err = store.TransitionOrder(ctx, order.ID, to, now); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionOrder error = %v, want %v", err, tt.wantErr)
+			}
+
+			got, err := store.GetOrder(ctx, order.ID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s", got.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTransitionOrderNotFound(t *testing.T) {
+	_, err := NewMemoryStore().TransitionOrder(context.Background(), "missing", OrderStatusPaid, time.Now())
+	if !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("error = %v, want %v", err, ErrOrderNotFound)
+	}
+}
+
+// orderStatusTime returns the timestamp Transition stamps for the status.
+func orderStatusTime(o *Order, status OrderStatus) time.Time {
+	switch status {
+	case OrderStatusPaid:
+		return o.PaidAt
+	case OrderStatusCancelled:
+		return o.CancelledAt
+	case OrderStatusExpired:
+		return o.ExpiredAt
+	case OrderStatusRefunded:
+		return o.RefundedAt
+	}
+	return time.Time{}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateOrderHandler is the single-course shortcut for creating a cart
+// and checking it out. Setting quantity buys several seats.
+func (s *Server) CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Define Order struct
+	type CreateOrderRequest struct {
+		Course     string `json:"course"`
+		Quantity   int    `json:"quantity"`
+		UserName   string `json:"user_name"`
+		UserEmail  string `json:"user_email"`
+		CouponCode string `json:"coupon_code"`
+		// Currency is the currency the order is charged in. It defaults
+		// to the course currency.
+		Currency string `json:"currency"`
+		// Country is the buyer's ISO 3166-1 alpha-2 country, used to
+		// compute tax. It defaults to the configured default country.
+		Country string `json:"country"`
+	}
+
+	// Parse request body
+	var newOrder CreateOrderRequest
+	err := json.NewDecoder(r.Body).Decode(&newOrder)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	req := orderRequest{
+		Items:      []OrderItem{{Course: newOrder.Course, Quantity: newOrder.Quantity}},
+		UserName:   newOrder.UserName,
+		UserEmail:  newOrder.UserEmail,
+		Currency:   newOrder.Currency,
+		Country:    newOrder.Country,
+		CouponCode: newOrder.CouponCode,
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	order, err := s.quoteOrder(r.Context(), req)
+	if err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	order.ID = uuid.New().String()
+
+	s.placeOrder(w, r, order, s.Store.CreateOrder)
+}
+
+// placeOrder opens a checkout session for the priced order, saves it with
+// save and writes the order id and payment URL.
+func (s *Server) placeOrder(w http.ResponseWriter, r *http.Request, order *Order, save func(ctx context.Context, order *Order) error) {
+	session, err := s.Payments.CreateCheckoutSession(r.Context(), order)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, CodePaymentProvider, "Error creating checkout session")
+		return
+	}
+	order.PaymentSessionID = session.ID
+	order.PaymentURL = session.URL
+
+	err = save(r.Context(), order)
+	if errors.Is(err, ErrCouponExhausted) || errors.Is(err, ErrCouponNotFound) {
+		writeCouponError(w, err)
+		return
+	}
+	if errors.Is(err, ErrCartCheckedOut) {
+		writeError(w, http.StatusConflict, CodeCartCheckedOut, "Cart has already been checked out")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving order")
+		return
+	}
+	s.queueOrderEmail(r.Context(), EmailOrderConfirmation, order)
+
+	// Create response with payment page URL
+	type CreateOrderResponse struct {
+		OrderID    string `json:"order_id"`
+		PaymentURL string `json:"payment_url"`
+	}
+
+	response := CreateOrderResponse{
+		OrderID:    order.ID,
+		PaymentURL: order.PaymentURL,
+	}
+
+	// Send response
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonResponse)
+}
+
+// ListOrdersHandler lists orders oldest first, optionally filtered by
+// user_email, status, course and created_after (RFC 3339). Pages are
+// requested with page_size and the next_page_token of the previous page.
+func (s *Server) ListOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	filter := OrderFilter{
+		UserEmail: q.Get("user_email"),
+		Status:    OrderStatus(q.Get("status")),
+		Course:    q.Get("course"),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid status")
+		return
+	}
+	if v := q.Get("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "created_after must be an RFC 3339 timestamp")
+			return
+		}
+		filter.CreatedAfter = t
+	}
+	if v := q.Get("page_token"); v != "" {
+		cursor, err := decodeOrderCursor(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid page_token")
+			return
+		}
+		filter.After = cursor
+	}
+	pageSize, err := parsePageSize(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	// Fetch one extra order to know whether there is a next page.
+	filter.Limit = pageSize + 1
+
+	orders, err := s.Store.ListOrders(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading orders")
+		return
+	}
+
+	type ListOrdersResponse struct {
+		Orders        []Order `json:"orders"`
+		NextPageToken string  `json:"next_page_token,omitempty"`
+	}
+
+	response := ListOrdersResponse{Orders: orders}
+	if len(orders) > pageSize {
+		response.Orders = orders[:pageSize]
+		last := response.Orders[pageSize-1]
+		response.NextPageToken = orderCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	orderID := vars["order"]
+
+	// Get order from database
+	order, err := s.Store.GetOrder(r.Context(), orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		writeError(w, http.StatusNotFound, CodeOrderNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading order")
+		return
+	}
+
+	// Prepare JSON response
+	jsonResponse, err := json.Marshal(order)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// PayOrderHandler completes the mock provider checkout for the order. The
+// order only becomes paid once the provider's signed webhook is accepted
+// by PaymentWebhookHandler.
+func (s *Server) PayOrderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	mock, ok := s.Payments.(*MockPaymentProvider)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["order"]
+
+	order, err := s.Store.GetOrder(r.Context(), orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		writeError(w, http.StatusNotFound, CodeOrderNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading order")
+		return
+	}
+	if order.IsExpired(s.Clock.Now()) {
+		writeError(w, http.StatusConflict, CodeOrderExpired, "Order has expired")
+		return
+	}
+	if !order.Status.CanTransitionTo(OrderStatusPaid) {
+		writeTransitionError(w, &TransitionError{From: order.Status, To: OrderStatusPaid})
+		return
+	}
+
+	if err := mock.CompleteCheckout(r.Context(), order); err != nil {
+		log.Printf("complete mock checkout for order %s error: %v", order.ID, err)
+		writeError(w, http.StatusBadGateway, CodePaymentProvider, "Payment failed")
+		return
+	}
+
+	order, err = s.Store.GetOrder(r.Context(), orderID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading order")
+		return
+	}
+
+	// Prepare JSON response
+	jsonResponse, err := json.Marshal(order)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	s.transitionOrderHandler(w, r, OrderStatusCancelled)
+}
+
+func (s *Server) RefundOrderHandler(w http.ResponseWriter, r *http.Request) {
+	s.transitionOrderHandler(w, r, OrderStatusRefunded)
+}
+
+// transitionOrderHandler moves the order in the path to the given status
+// and writes the updated order. Illegal moves are reported as 409.
+func (s *Server) transitionOrderHandler(w http.ResponseWriter, r *http.Request, to OrderStatus) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	orderID := vars["order"]
+
+	order, err := s.Store.TransitionOrder(r.Context(), orderID, to, s.Clock.Now())
+	if errors.Is(err, ErrOrderNotFound) {
+		writeError(w, http.StatusNotFound, CodeOrderNotFound, "Order not found")
+		return
+	}
+	if errors.Is(err, ErrOrderExpired) {
+		writeError(w, http.StatusConflict, CodeOrderExpired, "Order has expired")
+		return
+	}
+	if errors.Is(err, ErrInvalidOrderTransition) {
+		writeTransitionError(w, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving order")
+		return
+	}
+
+	// Prepare JSON response
+	jsonResponse, err := json.Marshal(order)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateOrderCountryFallback(t *testing.T) {
+	tests := []struct {
+		name           string
+		country        string
+		defaultCountry string
+		wantCountry    string
+		wantTax        float64
+	}{
+		{name: "request country", country: "DE", defaultCountry: "FR", wantCountry: "DE", wantTax: 19},
+		{name: "default country", defaultCountry: "DE", wantCountry: "DE", wantTax: 19},
+		{name: "untaxed", wantCountry: "", wantTax: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, _ := newPaymentTestServer(t)
+			s.Config.DefaultCountry = tt.defaultCountry
+			s.taxes = &TaxTable{Countries: map[string]TaxRate{"DE": {Name: "VAT", Rate: 0.19}}}
+			if err := s.Store.CreateCourse(ctx, &Course{Name: "go", Price: 100, Currency: "EUR"}); err != nil {
+				t.Fatalf("CreateCourse: %v", err)
+			}
+
+			body, _ := json.Marshal(map[string]string{
+				"course":     "go",
+				"user_name":  "Buyer",
+				"user_email": "buyer@example.com",
+				"country":    tt.country,
+			})
+			w := httptest.NewRecorder()
+			s.CreateOrderHandler(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(string(body))))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status code = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+			}
+
+			var resp struct {
+				OrderID string `json:"order_id"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			order, err := s.Store.GetOrder(ctx, resp.OrderID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if order.Country != tt.wantCountry || order.Tax != tt.wantTax {
+				t.Errorf("country, tax = %q, %v, want %q, %v", order.Country, order.Tax, tt.wantCountry, tt.wantTax)
+			}
+		})
+	}
+}
+
+func TestOrderRequestValidateUserEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		wantErr string
+	}{
+		{email: "buyer@example.com"},
+		{email: " buyer@example.com "},
+		{email: "", wantErr: "User email is required"},
+		{email: "   ", wantErr: "User email is required"},
+		{email: "buyer", wantErr: "User email must be a valid email address"},
+		{email: "buyer@", wantErr: "User email must be a valid email address"},
+		{email: "Buyer <buyer@example.com>", wantErr: "User email must be a valid email address"},
+		{email: "a@example.com, b@example.com", wantErr: "User email must be a valid email address"},
+	}
+	for _, tt := range tests {
+		req := orderRequest{Items: []OrderItem{{Course: "go"}}, UserEmail: tt.email}
+		errs := req.validate()
+		if tt.wantErr == "" {
+			if len(errs) > 0 {
+				t.Errorf("validate(%q) = %v, want no errors", tt.email, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != "user_email" || errs[0].Message != tt.wantErr {
+			t.Errorf("validate(%q) = %v, want user_email: %s", tt.email, errs, tt.wantErr)
+		}
+	}
+
+	// Carts are priced before the buyer is known.
+	req := orderRequest{Items: []OrderItem{{Course: "go"}}}
+	if errs := req.validateQuote(); len(errs) > 0 {
+		t.Errorf("validateQuote() = %v, want no errors", errs)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidPageToken = errors.New("invalid page token")
+
+// orderCursor points just past the last order of a page. Orders are
+// sorted by CreatedAt and then ID, so the pair is unique and stable.
+type orderCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (c orderCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(token string) (*orderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, errInvalidPageToken
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+	return &orderCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// CourseOrder is the sort order of ListCourses.
+type CourseOrder string
+
+const (
+	CourseOrderName      CourseOrder = "name"
+	CourseOrderNameDesc  CourseOrder = "name desc"
+	CourseOrderPrice     CourseOrder = "price"
+	CourseOrderPriceDesc CourseOrder = "price desc"
+)
+
+func (o CourseOrder) Valid() bool {
+	switch o {
+	case CourseOrderName, CourseOrderNameDesc, CourseOrderPrice, CourseOrderPriceDesc:
+		return true
+	}
+	return false
+}
+
+func (o CourseOrder) Desc() bool {
+	return o == CourseOrderNameDesc || o == CourseOrderPriceDesc
+}
+
+// courseCursor points just past the last course of a page. Name breaks
+// ties when sorting by price. The sort order is part of the cursor so a
+// token cannot be reused with a different order_by.
+type courseCursor struct {
+	OrderBy CourseOrder `json:"o"`
+	Price   float64     `json:"p,omitempty"`
+	Name    string      `json:"n"`
+}
+
+func (c courseCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCourseCursor(token string, orderBy CourseOrder) (*courseCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+	var c courseCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Name == "" || c.OrderBy != orderBy {
+		return nil, errInvalidPageToken
+	}
+	return &c, nil
+}
+
+// parsePageSize reads the page_size query parameter, falling back to
+// defaultPageSize and capping it at maxPageSize.
+func parsePageSize(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("page_size")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, errors.New("page_size must be a positive integer")
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
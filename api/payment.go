@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	paymentSignatureHeader = "Payment-Signature"
+	// paymentSignatureTolerance bounds how old a signed webhook may be
+	// before it is rejected as a replay.
+	paymentSignatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidPaymentSignature = errors.New("invalid payment webhook signature")
+
+type PaymentEventType string
+
+const (
+	PaymentEventCheckoutCompleted PaymentEventType = "checkout.completed"
+	PaymentEventChargeRefunded    PaymentEventType = "charge.refunded"
+)
+
+// CheckoutSession is a payment attempt for a single order at the provider.
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// PaymentEvent is the verified content of a provider webhook.
+type PaymentEvent struct {
+	ID        string           `json:"id"`
+	Type      PaymentEventType `json:"type"`
+	SessionID string           `json:"session_id"`
+	OrderID   string           `json:"order_id"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// PaymentProvider is the payment gateway orders are paid through.
+type PaymentProvider interface {
+	// CreateCheckoutSession starts a payment for the order and returns
+	// where the buyer has to go to pay.
+	CreateCheckoutSession(ctx context.Context, order *Order) (*CheckoutSession, error)
+	// VerifyWebhook authenticates a webhook request body and decodes it.
+	// It returns ErrInvalidPaymentSignature when the request was not sent
+	// by the provider.
+	VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error)
+}
+
+// signPayment returns the Payment-Signature header value for payload in
+// the form "t=<unix seconds>,v1=<hex hmac-sha256 of "t.payload">".
+func signPayment(secret []byte, payload []byte, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + ts + ",v1=" + paymentSignature(secret, ts, payload)
+}
+
+func paymentSignature(secret []byte, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPaymentSignature checks a header produced by signPayment.
+func verifyPaymentSignature(secret []byte, payload []byte, header string, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrInvalidPaymentSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidPaymentSignature
+	}
+	age := now.Sub(time.Unix(unix, 0))
+	if age > paymentSignatureTolerance || age < -paymentSignatureTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidPaymentSignature)
+	}
+
+	expected := paymentSignature(secret, ts, payload)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrInvalidPaymentSignature
+	}
+	return nil
+}
+
+// PaymentWebhookHandler receives payment events from the provider. Only
+// requests with a valid signature can move an order to paid or refunded.
+func (s *Server) PaymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	event, err := s.Payments.VerifyWebhook(payload, r.Header)
+	if errors.Is(err, ErrInvalidPaymentSignature) {
+		writeError(w, http.StatusUnauthorized, CodeInvalidSignature, "Invalid signature")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidPaymentEvent, "Invalid payment event")
+		return
+	}
+
+	var to OrderStatus
+	switch event.Type {
+	case PaymentEventCheckoutCompleted:
+		to = OrderStatusPaid
+	case PaymentEventChargeRefunded:
+		to = OrderStatusRefunded
+	default:
+		// Acknowledge events we don't care about so the provider stops
+		// retrying them.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	order, err := s.Store.GetOrder(r.Context(), event.OrderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		writeError(w, http.StatusNotFound, CodeOrderNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading order")
+		return
+	}
+	if order.PaymentSessionID != event.SessionID {
+		writeError(w, http.StatusBadRequest, CodePaymentSessionInvalid, "Checkout session does not belong to order")
+		return
+	}
+	if order.Status == to {
+		// Providers deliver at least once; a repeated event is not an error.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	updated, err := s.Store.TransitionOrder(r.Context(), order.ID, to, s.Clock.Now())
+	if errors.Is(err, ErrInvalidOrderTransition) || errors.Is(err, ErrOrderExpired) {
+		log.Printf("payment event %s for order %s rejected: %v", event.ID, order.ID, err)
+		writeTransitionError(w, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving order")
+		return
+	}
+	if to == OrderStatusPaid {
+		s.queueOrderEmail(r.Context(), EmailPaymentReceipt, updated)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodePaymentEvent(payload []byte) (*PaymentEvent, error) {
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if event.Type == "" || event.OrderID == "" {
+		return nil, errors.New("payment event is missing type or order_id")
+	}
+	return &event, nil
+}
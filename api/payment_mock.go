@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MockPaymentProvider is a payment provider that runs inside the API for
+// local development. Its checkout page is the order payment page and
+// completing a checkout sends a signed webhook back to the API, exactly
+// like a real gateway would.
+type MockPaymentProvider struct {
+	// BaseURL is the public URL of this API, used for checkout pages and
+	// as the webhook destination.
+	BaseURL string
+	Secret  []byte
+	// OrderTokenSecret signs the checkout page links so buyers can open
+	// them without an API key.
+	OrderTokenSecret []byte
+	Clock            Clock
+	Client           *http.Client
+}
+
+func (p *MockPaymentProvider) CreateCheckoutSession(ctx context.Context, order *Order) (*CheckoutSession, error) {
+	return &CheckoutSession{
+		ID:  "cs_mock_" + uuid.New().String(),
+		URL: fmt.Sprintf("%s/orders/%s/payment?token=%s", p.BaseURL, order.ID, signOrderToken(p.OrderTokenSecret, order.ID)),
+	}, nil
+}
+
+func (p *MockPaymentProvider) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	if err := verifyPaymentSignature(p.Secret, payload, header.Get(paymentSignatureHeader), p.Clock.Now()); err != nil {
+		return nil, err
+	}
+	return decodePaymentEvent(payload)
+}
+
+// CompleteCheckout simulates the buyer finishing the checkout session of
+// the order by delivering a signed checkout.completed webhook.
+func (p *MockPaymentProvider) CompleteCheckout(ctx context.Context, order *Order) error {
+	now := p.Clock.Now()
+	event := PaymentEvent{
+		ID:        "evt_mock_" + uuid.New().String(),
+		Type:      PaymentEventCheckoutCompleted,
+		SessionID: order.PaymentSessionID,
+		OrderID:   order.ID,
+		CreatedAt: now,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/webhooks/payments", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(paymentSignatureHeader, signPayment(p.Secret, payload, now))
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("payment webhook returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPaymentSecret = "payment-secret"
+
+func newPaymentTestServer(t *testing.T) (*Server, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock(time.Now().Truncate(time.Second))
+	s := &Server{
+		Config: &Config{},
+		Store:  NewMemoryStore(),
+		Clock:  clock,
+		Payments: &MockPaymentProvider{
+			Secret: []byte(testPaymentSecret),
+			Clock:  clock,
+		},
+	}
+	return s, clock
+}
+
+// postPaymentEvent sends a correctly signed payment event for the order
+// to the webhook handler.
+func postPaymentEvent(t *testing.T, s *Server, order *Order, eventType PaymentEventType) *httptest.ResponseRecorder {
+	t.Helper()
+	now := s.Clock.Now()
+	payload, err := json.Marshal(PaymentEvent{
+		ID:        "evt_test",
+		Type:      eventType,
+		SessionID: order.PaymentSessionID,
+		OrderID:   order.ID,
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/payments", strings.NewReader(string(payload)))
+	r.Header.Set(paymentSignatureHeader, signPayment([]byte(testPaymentSecret), payload, now))
+	w := httptest.NewRecorder()
+	s.PaymentWebhookHandler(w, r)
+	return w
+}
+
+func TestPaymentWebhookTransitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     OrderStatus
+		expired    bool
+		event      PaymentEventType
+		wantCode   int
+		wantStatus OrderStatus
+	}{
+		{name: "pay pending", status: OrderStatusPending, event: PaymentEventCheckoutCompleted, wantCode: http.StatusNoContent, wantStatus: OrderStatusPaid},
+		{name: "refund paid", status: OrderStatusPaid, event: PaymentEventChargeRefunded, wantCode: http.StatusNoContent, wantStatus: OrderStatusRefunded},
+		{name: "repeated payment", status: OrderStatusPaid, event: PaymentEventCheckoutCompleted, wantCode: http.StatusNoContent, wantStatus: OrderStatusPaid},
+		{name: "pay cancelled", status: OrderStatusCancelled, event: PaymentEventCheckoutCompleted, wantCode: http.StatusConflict, wantStatus: OrderStatusCancelled},
+		{name: "pay after window", status: OrderStatusPending, expired: true, event: PaymentEventCheckoutCompleted, wantCode: http.StatusConflict, wantStatus: OrderStatusPending},
+		{name: "refund pending", status: OrderStatusPending, event: PaymentEventChargeRefunded, wantCode: http.StatusConflict, wantStatus: OrderStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, clock := newPaymentTestServer(t)
+			order := &Order{
+				ID:               "order",
+				Status:           tt.status,
+				UserEmail:        "buyer@example.com",
+				PaymentSessionID: "cs_test",
+				CreatedAt:        clock.Now(),
+				ExpiresAt:        clock.Now().Add(time.Minute),
+			}
+			if err := s.Store.CreateOrder(ctx, order); err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+			if tt.expired {
+				clock.Advance(time.Hour)
+			}
+
+			w := postPaymentEvent(t, s, order, tt.event)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status code = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			got, err := s.Store.GetOrder(ctx, order.ID)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("order status = %s, want %s", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPaymentWebhookRejectsBadSignature(t *testing.T) {
+	s, clock := newPaymentTestServer(t)
+	payload := `{"id":"evt_test","type":"checkout.completed","order_id":"order"}`
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/payments", strings.NewReader(payload))
+	r.Header.Set(paymentSignatureHeader, signPayment([]byte("wrong secret"), []byte(payload), clock.Now()))
+	w := httptest.NewRecorder()
+	s.PaymentWebhookHandler(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/lib/pq"
+)
+
+func NewSQLx() (*sqlx.DB, error) {
+	ds := fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s sslmode=disable",
+		os.Getenv("COURSES_API_DB_USER"),
+		os.Getenv("COURSES_API_DB_PASSWORD"),
+		os.Getenv("COURSES_API_DB_HOST"),
+		os.Getenv("COURSES_API_DB_PORT"),
+		os.Getenv("COURSES_API_DB_NAME"))
+	return sqlx.Open("postgres", ds)
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		db: db,
+		sb: sq.StatementBuilder.PlaceholderFormat(sq.Dollar).RunWith(db),
+	}
+}
+
+// PostgresStore persists courses and orders in PostgreSQL. The schema is
+// managed by Migrate.
+type PostgresStore struct {
+	db *sqlx.DB
+	sb sq.StatementBuilderType
+}
+
+var courseColumns = []string{"name", "display_name", "description", "price", "currency", "archived", "prices"}
+
+func (s *PostgresStore) ListCourses(ctx context.Context, filter CourseFilter) ([]Course, error) {
+	q := s.sb.Select(courseColumns...).
+		From("courses").
+		Where(sq.Eq{"archived": false})
+	if filter.Query != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Query) + "%"
+		q = q.Where(sq.Or{
+			sq.ILike{"display_name": pattern},
+			sq.ILike{"description": pattern},
+		})
+	}
+
+	cmp, dir := ">", ""
+	if filter.OrderBy.Desc() {
+		cmp, dir = "<", " DESC"
+	}
+	switch filter.OrderBy {
+	case CourseOrderPrice, CourseOrderPriceDesc:
+		if filter.After != nil {
+			q = q.Where("(price, name) "+cmp+" (?, ?)", filter.After.Price, filter.After.Name)
+		}
+		q = q.OrderBy("price"+dir, "name"+dir)
+	default:
+		if filter.After != nil {
+			q = q.Where("name "+cmp+" ?", filter.After.Name)
+		}
+		q = q.OrderBy("name" + dir)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(uint64(filter.Limit))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	courses := []Course{}
+	if err := s.db.SelectContext(ctx, &courses, query, args...); err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+// likeEscaper escapes LIKE wildcards so user input matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *PostgresStore) GetCourse(ctx context.Context, name string) (*Course, error) {
+	query, args, err := s.sb.Select(courseColumns...).
+		From("courses").
+		Where(sq.Eq{"name": name}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var c Course
+	if err := s.db.GetContext(ctx, &c, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCourseNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *PostgresStore) CreateCourse(ctx context.Context, course *Course) error {
+	res, err := s.sb.Insert("courses").
+		Columns(courseColumns...).
+		Values(course.Name, course.DisplayName, course.Description, course.Price, course.Currency, course.Archived, course.Prices).
+		Suffix("ON CONFLICT (name) DO NOTHING").
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrCourseExists)
+}
+
+func (s *PostgresStore) UpdateCourse(ctx context.Context, course *Course) error {
+	res, err := s.sb.Update("courses").
+		SetMap(map[string]interface{}{
+			"display_name": course.DisplayName,
+			"description":  course.Description,
+			"price":        course.Price,
+			"currency":     course.Currency,
+			"archived":     course.Archived,
+			"prices":       course.Prices,
+		}).
+		Where(sq.Eq{"name": course.Name}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrCourseNotFound)
+}
+
+func (s *PostgresStore) ArchiveCourse(ctx context.Context, name string) error {
+	res, err := s.sb.Update("courses").
+		Set("archived", true).
+		Where(sq.Eq{"name": name}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrCourseNotFound)
+}
+
+// expectRows returns errNone when the statement did not touch any row.
+func expectRows(res sql.Result, errNone error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNone
+	}
+	return nil
+}
+
+var orderColumns = []string{
+	"id", "course", "price", "currency", "user_email", "user_name", "status",
+	"created_at", "paid_at", "cancelled_at", "expired_at", "refunded_at", "expires_at",
+	"payment_session_id", "payment_url",
+	"original_price", "discount", "coupon_code",
+	"country", "subtotal", "tax_name", "tax_rate", "tax", "total",
+	"items",
+}
+
+// orderRow mirrors the orders table. Nullable columns are kept separate
+// from Order so the JSON representation stays unchanged.
+type orderRow struct {
+	ID          string       `db:"id"`
+	Course      string       `db:"course"`
+	Price       float64      `db:"price"`
+	Currency    string       `db:"currency"`
+	UserEmail   string       `db:"user_email"`
+	UserName    string       `db:"user_name"`
+	Status      string       `db:"status"`
+	CreatedAt   time.Time    `db:"created_at"`
+	PaidAt      sql.NullTime `db:"paid_at"`
+	CancelledAt sql.NullTime `db:"cancelled_at"`
+	ExpiredAt   sql.NullTime `db:"expired_at"`
+	RefundedAt  sql.NullTime `db:"refunded_at"`
+	ExpiresAt   sql.NullTime `db:"expires_at"`
+
+	PaymentSessionID string `db:"payment_session_id"`
+	PaymentURL       string `db:"payment_url"`
+
+	OriginalPrice float64 `db:"original_price"`
+	Discount      float64 `db:"discount"`
+	CouponCode    string  `db:"coupon_code"`
+
+	Country  string  `db:"country"`
+	Subtotal float64 `db:"subtotal"`
+	TaxName  string  `db:"tax_name"`
+	TaxRate  float64 `db:"tax_rate"`
+	Tax      float64 `db:"tax"`
+	Total    float64 `db:"total"`
+
+	Items OrderItems `db:"items"`
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func newOrderRow(o *Order) orderRow {
+	return orderRow{
+		ID:          o.ID,
+		Course:      o.Course,
+		Price:       o.Price,
+		Currency:    o.Currency,
+		UserEmail:   o.UserEmail,
+		UserName:    o.UserName,
+		Status:      string(o.Status),
+		CreatedAt:   o.CreatedAt,
+		PaidAt:      nullTime(o.PaidAt),
+		CancelledAt: nullTime(o.CancelledAt),
+		ExpiredAt:   nullTime(o.ExpiredAt),
+		RefundedAt:  nullTime(o.RefundedAt),
+		ExpiresAt:   nullTime(o.ExpiresAt),
+
+		PaymentSessionID: o.PaymentSessionID,
+		PaymentURL:       o.PaymentURL,
+
+		OriginalPrice: o.OriginalPrice,
+		Discount:      o.Discount,
+		CouponCode:    o.CouponCode,
+
+		Country:  o.Country,
+		Subtotal: o.Subtotal,
+		TaxName:  o.TaxName,
+		TaxRate:  o.TaxRate,
+		Tax:      o.Tax,
+		Total:    o.Total,
+
+		Items: o.Items,
+	}
+}
+
+func (r orderRow) Order() *Order {
+	return &Order{
+		ID:          r.ID,
+		Course:      r.Course,
+		Price:       r.Price,
+		Currency:    r.Currency,
+		UserEmail:   r.UserEmail,
+		UserName:    r.UserName,
+		Status:      OrderStatus(r.Status),
+		CreatedAt:   r.CreatedAt,
+		PaidAt:      r.PaidAt.Time,
+		CancelledAt: r.CancelledAt.Time,
+		ExpiredAt:   r.ExpiredAt.Time,
+		RefundedAt:  r.RefundedAt.Time,
+		ExpiresAt:   r.ExpiresAt.Time,
+
+		PaymentSessionID: r.PaymentSessionID,
+		PaymentURL:       r.PaymentURL,
+
+		OriginalPrice: r.OriginalPrice,
+		Discount:      r.Discount,
+		CouponCode:    r.CouponCode,
+
+		Country:  r.Country,
+		Subtotal: r.Subtotal,
+		TaxName:  r.TaxName,
+		TaxRate:  r.TaxRate,
+		Tax:      r.Tax,
+		Total:    r.Total,
+
+		Items: r.Items,
+	}
+}
+
+func (r orderRow) values() []interface{} {
+	return []interface{}{
+		r.ID, r.Course, r.Price, r.Currency, r.UserEmail, r.UserName, r.Status,
+		r.CreatedAt, r.PaidAt, r.CancelledAt, r.ExpiredAt, r.RefundedAt, r.ExpiresAt,
+		r.PaymentSessionID, r.PaymentURL,
+		r.OriginalPrice, r.Discount, r.CouponCode,
+		r.Country, r.Subtotal, r.TaxName, r.TaxRate, r.Tax, r.Total,
+		r.Items,
+	}
+}
+
+func (r orderRow) updates() map[string]interface{} {
+	return map[string]interface{}{
+		"course":       r.Course,
+		"price":        r.Price,
+		"currency":     r.Currency,
+		"user_email":   r.UserEmail,
+		"user_name":    r.UserName,
+		"status":       r.Status,
+		"paid_at":      r.PaidAt,
+		"cancelled_at": r.CancelledAt,
+		"expired_at":   r.ExpiredAt,
+		"refunded_at":  r.RefundedAt,
+		"expires_at":   r.ExpiresAt,
+
+		"payment_session_id": r.PaymentSessionID,
+		"payment_url":        r.PaymentURL,
+
+		"original_price": r.OriginalPrice,
+		"discount":       r.Discount,
+		"coupon_code":    r.CouponCode,
+
+		"country":  r.Country,
+		"subtotal": r.Subtotal,
+		"tax_name": r.TaxName,
+		"tax_rate": r.TaxRate,
+		"tax":      r.Tax,
+		"total":    r.Total,
+
+		"items": r.Items,
+	}
+}
+
+func (s *PostgresStore) CreateOrder(ctx context.Context, order *Order) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertOrder(ctx, tx, order); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertOrder redeems the order's coupon, inserts the order and queues the
+// order.created event within tx.
+func (s *PostgresStore) insertOrder(ctx context.Context, tx *sqlx.Tx, order *Order) error {
+	if order.CouponCode != "" {
+		if err := s.redeemCoupon(ctx, tx, order.CouponCode); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.sb.Insert("orders").
+		Columns(orderColumns...).
+		Values(newOrderRow(order).values()...).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return s.enqueueWebhookEvent(ctx, tx, WebhookEventOrderCreated, order, order.CreatedAt)
+}
+
+func (s *PostgresStore) GetOrder(ctx context.Context, id string) (*Order, error) {
+	query, args, err := s.sb.Select(orderColumns...).
+		From("orders").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r orderRow
+	if err := s.db.GetContext(ctx, &r, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return r.Order(), nil
+}
+
+func (s *PostgresStore) ListOrders(ctx context.Context, filter OrderFilter) ([]Order, error) {
+	q := s.sb.Select(orderColumns...).
+		From("orders").
+		OrderBy("created_at", "id")
+	if filter.UserEmail != "" {
+		q = q.Where(sq.Eq{"user_email": filter.UserEmail})
+	}
+	if filter.Status != "" {
+		q = q.Where(sq.Eq{"status": string(filter.Status)})
+	}
+	if filter.Course != "" {
+		item, _ := json.Marshal([]OrderItem{{Course: filter.Course}})
+		q = q.Where("items @> ?::jsonb", string(item))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		q = q.Where(sq.Gt{"created_at": filter.CreatedAfter})
+	}
+	if !filter.ExpiresBefore.IsZero() {
+		q = q.Where(sq.Lt{"expires_at": filter.ExpiresBefore})
+	}
+	if filter.After != nil {
+		q = q.Where("(created_at, id) > (?, ?)", filter.After.CreatedAt, filter.After.ID)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(uint64(filter.Limit))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []orderRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	orders := make([]Order, 0, len(rows))
+	for _, r := range rows {
+		orders = append(orders, *r.Order())
+	}
+	return orders, nil
+}
+
+func (s *PostgresStore) TransitionOrder(ctx context.Context, id string, to OrderStatus, at time.Time) (*Order, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sb.Select(orderColumns...).
+		From("orders").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r orderRow
+	if err := tx.GetContext(ctx, &r, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	order := r.Order()
+	if err := order.Transition(to, at); err != nil {
+		return nil, err
+	}
+
+	query, args, err = s.sb.Update("orders").
+		SetMap(newOrderRow(order).updates()).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	if err := s.syncEnrollments(ctx, tx, order); err != nil {
+		return nil, err
+	}
+	if err := s.releaseCoupon(ctx, tx, order); err != nil {
+		return nil, err
+	}
+	if event, ok := orderStatusEvents[to]; ok {
+		if err := s.enqueueWebhookEvent(ctx, tx, event, order, at); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *PostgresStore) ExpireOrders(ctx context.Context, now time.Time) ([]Order, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sb.Update("orders").
+		Set("status", string(OrderStatusExpired)).
+		Set("expired_at", now).
+		Where(sq.Eq{"status": string(OrderStatusPending)}).
+		Where(sq.LtOrEq{"expires_at": now}).
+		Suffix("RETURNING " + strings.Join(orderColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []orderRow
+	if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	orders := make([]Order, 0, len(rows))
+	for _, r := range rows {
+		order := r.Order()
+		if err := s.releaseCoupon(ctx, tx, order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+var idempotencyColumns = []string{"scope", "key", "request_hash", "status_code", "body", "created_at"}
+
+func (s *PostgresStore) CreateIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord) error {
+	res, err := s.sb.Insert("idempotency_keys").
+		Columns(idempotencyColumns...).
+		Values(rec.Scope, rec.Key, rec.RequestHash, rec.StatusCode, rec.Body, rec.CreatedAt).
+		Suffix("ON CONFLICT (scope, key) DO NOTHING").
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrIdempotencyKeyExists)
+}
+
+func (s *PostgresStore) GetIdempotencyRecord(ctx context.Context, scope, key string) (*IdempotencyRecord, error) {
+	query, args, err := s.sb.Select(idempotencyColumns...).
+		From("idempotency_keys").
+		Where(sq.Eq{"scope": scope, "key": key}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rec IdempotencyRecord
+	if err := s.db.GetContext(ctx, &rec, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdempotencyRecordNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *PostgresStore) CompleteIdempotencyRecord(ctx context.Context, scope, key string, statusCode int, body []byte) error {
+	res, err := s.sb.Update("idempotency_keys").
+		Set("status_code", statusCode).
+		Set("body", body).
+		Where(sq.Eq{"scope": scope, "key": key}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrIdempotencyRecordNotFound)
+}
+
+func (s *PostgresStore) DeleteIdempotencyRecord(ctx context.Context, scope, key string) error {
+	_, err := s.sb.Delete("idempotency_keys").
+		Where(sq.Eq{"scope": scope, "key": key}).
+		ExecContext(ctx)
+	return err
+}
+
+func (s *PostgresStore) ReclaimIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord, createdAt time.Time) error {
+	res, err := s.sb.Update("idempotency_keys").
+		Set("request_hash", rec.RequestHash).
+		Set("status_code", rec.StatusCode).
+		Set("body", rec.Body).
+		Set("created_at", rec.CreatedAt).
+		Where(sq.Eq{"scope": rec.Scope, "key": rec.Key, "created_at": createdAt}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrIdempotencyKeyExists)
+}
+
+func (s *PostgresStore) DeleteIdempotencyRecords(ctx context.Context, before time.Time) error {
+	_, err := s.sb.Delete("idempotency_keys").
+		Where(sq.Lt{"created_at": before}).
+		ExecContext(ctx)
+	return err
+}
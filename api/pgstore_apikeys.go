@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+var apiKeyColumns = []string{"id", "name", "prefix", "hash", "scopes", "created_at", "revoked_at"}
+
+// apiKeyRow mirrors the api_keys table.
+type apiKeyRow struct {
+	ID        string         `db:"id"`
+	Name      string         `db:"name"`
+	Prefix    string         `db:"prefix"`
+	Hash      string         `db:"hash"`
+	Scopes    pq.StringArray `db:"scopes"`
+	CreatedAt time.Time      `db:"created_at"`
+	RevokedAt sql.NullTime   `db:"revoked_at"`
+}
+
+func (r apiKeyRow) APIKey() *APIKey {
+	scopes := make([]Scope, len(r.Scopes))
+	for i, scope := range r.Scopes {
+		scopes[i] = Scope(scope)
+	}
+	return &APIKey{
+		ID:        r.ID,
+		Name:      r.Name,
+		Prefix:    r.Prefix,
+		Hash:      r.Hash,
+		Scopes:    scopes,
+		CreatedAt: r.CreatedAt,
+		RevokedAt: r.RevokedAt.Time,
+	}
+}
+
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	scopes := make(pq.StringArray, len(k.Scopes))
+	for i, scope := range k.Scopes {
+		scopes[i] = string(scope)
+	}
+	_, err := s.sb.Insert("api_keys").
+		Columns(apiKeyColumns...).
+		Values(k.ID, k.Name, k.Prefix, k.Hash, scopes, k.CreatedAt, nullTime(k.RevokedAt)).
+		ExecContext(ctx)
+	return err
+}
+
+func (s *PostgresStore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	query, args, err := s.sb.Select(apiKeyColumns...).
+		From("api_keys").
+		Where(sq.Eq{"hash": hash}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r apiKeyRow
+	err = s.db.GetContext(ctx, &r, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.APIKey(), nil
+}
+
+func (s *PostgresStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	query, args, err := s.sb.Select(apiKeyColumns...).
+		From("api_keys").
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []apiKeyRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	keys := make([]APIKey, 0, len(rows))
+	for _, r := range rows {
+		keys = append(keys, *r.APIKey())
+	}
+	return keys, nil
+}
+
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	res, err := s.sb.Update("api_keys").
+		Set("revoked_at", sq.Expr("COALESCE(revoked_at, ?)", at)).
+		Where(sq.Eq{"id": id}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrAPIKeyNotFound)
+}
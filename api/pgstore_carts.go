@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var cartColumns = []string{
+	"id", "items", "currency", "country", "coupon_code", "order_id", "created_at", "updated_at",
+}
+
+// cartRow mirrors the carts table.
+type cartRow struct {
+	ID         string     `db:"id"`
+	Items      OrderItems `db:"items"`
+	Currency   string     `db:"currency"`
+	Country    string     `db:"country"`
+	CouponCode string     `db:"coupon_code"`
+	OrderID    string     `db:"order_id"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at"`
+}
+
+func (r cartRow) Cart() *Cart {
+	return &Cart{
+		ID:         r.ID,
+		Items:      r.Items,
+		Currency:   r.Currency,
+		Country:    r.Country,
+		CouponCode: r.CouponCode,
+		OrderID:    r.OrderID,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+}
+
+func (s *PostgresStore) CreateCart(ctx context.Context, c *Cart) error {
+	_, err := s.sb.Insert("carts").
+		Columns(cartColumns...).
+		Values(c.ID, OrderItems(c.Items), c.Currency, c.Country, c.CouponCode, c.OrderID, c.CreatedAt, c.UpdatedAt).
+		ExecContext(ctx)
+	return err
+}
+
+func (s *PostgresStore) GetCart(ctx context.Context, id string) (*Cart, error) {
+	query, args, err := s.sb.Select(cartColumns...).
+		From("carts").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r cartRow
+	err = s.db.GetContext(ctx, &r, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.Cart(), nil
+}
+
+func (s *PostgresStore) UpdateCart(ctx context.Context, c *Cart) error {
+	res, err := s.sb.Update("carts").
+		SetMap(map[string]interface{}{
+			"items":       OrderItems(c.Items),
+			"currency":    c.Currency,
+			"country":     c.Country,
+			"coupon_code": c.CouponCode,
+			"updated_at":  c.UpdatedAt,
+		}).
+		Where(sq.Eq{"id": c.ID, "order_id": ""}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+	// Nothing was updated: tell a missing cart from a checked out one.
+	if _, err := s.GetCart(ctx, c.ID); err != nil {
+		return err
+	}
+	return ErrCartCheckedOut
+}
+
+func (s *PostgresStore) CheckoutCart(ctx context.Context, cartID string, order *Order) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orderID string
+	err = tx.GetContext(ctx, &orderID, "SELECT order_id FROM carts WHERE id = $1 FOR UPDATE", cartID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCartNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if orderID != "" {
+		return ErrCartCheckedOut
+	}
+
+	if err := s.insertOrder(ctx, tx, order); err != nil {
+		return err
+	}
+	_, err = s.sb.Update("carts").
+		Set("order_id", order.ID).
+		Set("updated_at", order.CreatedAt).
+		Where(sq.Eq{"id": cartID}).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var couponColumns = []string{
+	"code", "type", "value", "currency", "courses", "expires_at",
+	"max_redemptions", "redemptions", "disabled", "created_at",
+}
+
+// couponRow mirrors the coupons table.
+type couponRow struct {
+	Code           string         `db:"code"`
+	Type           string         `db:"type"`
+	Value          float64        `db:"value"`
+	Currency       string         `db:"currency"`
+	Courses        pq.StringArray `db:"courses"`
+	ExpiresAt      sql.NullTime   `db:"expires_at"`
+	MaxRedemptions int            `db:"max_redemptions"`
+	Redemptions    int            `db:"redemptions"`
+	Disabled       bool           `db:"disabled"`
+	CreatedAt      time.Time      `db:"created_at"`
+}
+
+func (r couponRow) Coupon() *Coupon {
+	courses := []string(r.Courses)
+	if courses == nil {
+		courses = []string{}
+	}
+	return &Coupon{
+		Code:           r.Code,
+		Type:           CouponType(r.Type),
+		Value:          r.Value,
+		Currency:       r.Currency,
+		Courses:        courses,
+		ExpiresAt:      r.ExpiresAt.Time,
+		MaxRedemptions: r.MaxRedemptions,
+		Redemptions:    r.Redemptions,
+		Disabled:       r.Disabled,
+		CreatedAt:      r.CreatedAt,
+	}
+}
+
+func (s *PostgresStore) CreateCoupon(ctx context.Context, c *Coupon) error {
+	res, err := s.sb.Insert("coupons").
+		Columns(couponColumns...).
+		Values(c.Code, string(c.Type), c.Value, c.Currency, pq.StringArray(c.Courses), nullTime(c.ExpiresAt),
+			c.MaxRedemptions, c.Redemptions, c.Disabled, c.CreatedAt).
+		Suffix("ON CONFLICT (code) DO NOTHING").
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrCouponExists)
+}
+
+func (s *PostgresStore) GetCoupon(ctx context.Context, code string) (*Coupon, error) {
+	query, args, err := s.sb.Select(couponColumns...).
+		From("coupons").
+		Where(sq.Eq{"code": code}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r couponRow
+	if err := s.db.GetContext(ctx, &r, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+	return r.Coupon(), nil
+}
+
+func (s *PostgresStore) ListCoupons(ctx context.Context) ([]Coupon, error) {
+	query, args, err := s.sb.Select(couponColumns...).
+		From("coupons").
+		OrderBy("code").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []couponRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	coupons := make([]Coupon, 0, len(rows))
+	for _, r := range rows {
+		coupons = append(coupons, *r.Coupon())
+	}
+	return coupons, nil
+}
+
+func (s *PostgresStore) DisableCoupon(ctx context.Context, code string) error {
+	res, err := s.sb.Update("coupons").
+		Set("disabled", true).
+		Where(sq.Eq{"code": code}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrCouponNotFound)
+}
+
+// redeemCoupon counts one use of the coupon inside tx, failing with
+// ErrCouponExhausted when its usage limit has been reached.
+func (s *PostgresStore) redeemCoupon(ctx context.Context, tx *sqlx.Tx, code string) error {
+	res, err := s.sb.Update("coupons").
+		Set("redemptions", sq.Expr("redemptions + 1")).
+		Where(sq.Eq{"code": code}).
+		Where(sq.Or{
+			sq.Eq{"max_redemptions": 0},
+			sq.Expr("redemptions < max_redemptions"),
+		}).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrCouponExhausted)
+}
+
+// releaseCoupon gives back the coupon redemption of an order that was not
+// paid, inside tx.
+func (s *PostgresStore) releaseCoupon(ctx context.Context, tx *sqlx.Tx, order *Order) error {
+	if order.CouponCode == "" || !order.Status.releasesCoupon() {
+		return nil
+	}
+	_, err := s.sb.Update("coupons").
+		Set("redemptions", sq.Expr("redemptions - 1")).
+		Where(sq.Eq{"code": order.CouponCode}).
+		Where(sq.Gt{"redemptions": 0}).
+		RunWith(tx).
+		ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var emailColumns = []string{
+	"id", "kind", "order_id", "recipient", "subject", "body", "status",
+	"attempts", "last_error", "next_attempt_at", "created_at", "sent_at",
+}
+
+// emailRow mirrors the emails table.
+type emailRow struct {
+	ID            string       `db:"id"`
+	Kind          string       `db:"kind"`
+	OrderID       string       `db:"order_id"`
+	Recipient     string       `db:"recipient"`
+	Subject       string       `db:"subject"`
+	Body          string       `db:"body"`
+	Status        string       `db:"status"`
+	Attempts      int          `db:"attempts"`
+	LastError     string       `db:"last_error"`
+	NextAttemptAt sql.NullTime `db:"next_attempt_at"`
+	CreatedAt     time.Time    `db:"created_at"`
+	SentAt        sql.NullTime `db:"sent_at"`
+}
+
+func (r emailRow) Email() Email {
+	return Email{
+		ID:            r.ID,
+		Kind:          EmailKind(r.Kind),
+		OrderID:       r.OrderID,
+		To:            r.Recipient,
+		Subject:       r.Subject,
+		Body:          r.Body,
+		Status:        EmailStatus(r.Status),
+		Attempts:      r.Attempts,
+		LastError:     r.LastError,
+		NextAttemptAt: r.NextAttemptAt.Time,
+		CreatedAt:     r.CreatedAt,
+		SentAt:        r.SentAt.Time,
+	}
+}
+
+func (s *PostgresStore) EnqueueEmail(ctx context.Context, e *Email) error {
+	res, err := s.sb.Insert("emails").
+		Columns(emailColumns...).
+		Values(e.ID, string(e.Kind), e.OrderID, e.To, e.Subject, e.Body, string(e.Status),
+			e.Attempts, e.LastError, nullTime(e.NextAttemptAt), e.CreatedAt, nullTime(e.SentAt)).
+		Suffix("ON CONFLICT (id) DO NOTHING").
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrEmailExists)
+}
+
+func (s *PostgresStore) ClaimEmails(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Email, error) {
+	// Same claiming scheme as ClaimWebhookDeliveries.
+	due, dueArgs, err := sq.Select("id").
+		From("emails").
+		Where(sq.Eq{"status": string(EmailStatusPending)}).
+		Where(sq.LtOrEq{"next_attempt_at": now}).
+		OrderBy("next_attempt_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := s.sb.Update("emails").
+		Set("next_attempt_at", now.Add(lease)).
+		Where(sq.Expr("id IN ("+due+")", dueArgs...)).
+		Suffix("RETURNING " + strings.Join(emailColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []emailRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	emails := make([]Email, 0, len(rows))
+	for _, r := range rows {
+		emails = append(emails, r.Email())
+	}
+	return emails, nil
+}
+
+func (s *PostgresStore) RecordEmailAttempt(ctx context.Context, id string, attempts int, lastError string, status EmailStatus, at time.Time) error {
+	var next, sent time.Time
+	switch status {
+	case EmailStatusSent:
+		sent = at
+	case EmailStatusPending:
+		next = at
+	}
+	_, err := s.sb.Update("emails").
+		SetMap(map[string]interface{}{
+			"attempts":        attempts,
+			"last_error":      lastError,
+			"status":          string(status),
+			"next_attempt_at": nullTime(next),
+			"sent_at":         nullTime(sent),
+		}).
+		Where(sq.Eq{"id": id}).
+		ExecContext(ctx)
+	return err
+}
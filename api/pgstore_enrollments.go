@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+var enrollmentColumns = []string{
+	"order_id", "course", "user_email", "seats", "status", "created_at", "revoked_at",
+}
+
+// enrollmentRow mirrors the enrollments table.
+type enrollmentRow struct {
+	OrderID   string       `db:"order_id"`
+	Course    string       `db:"course"`
+	UserEmail string       `db:"user_email"`
+	Seats     int          `db:"seats"`
+	Status    string       `db:"status"`
+	CreatedAt time.Time    `db:"created_at"`
+	RevokedAt sql.NullTime `db:"revoked_at"`
+}
+
+func (r enrollmentRow) Enrollment() Enrollment {
+	return Enrollment{
+		UserEmail: r.UserEmail,
+		Course:    r.Course,
+		OrderID:   r.OrderID,
+		Seats:     r.Seats,
+		Status:    EnrollmentStatus(r.Status),
+		CreatedAt: r.CreatedAt,
+		RevokedAt: r.RevokedAt.Time,
+	}
+}
+
+// syncEnrollments grants or revokes the enrollments of an order that has
+// just been paid or refunded within tx.
+func (s *PostgresStore) syncEnrollments(ctx context.Context, tx *sqlx.Tx, o *Order) error {
+	switch o.Status {
+	case OrderStatusPaid:
+		q := s.sb.Insert("enrollments").
+			Columns(enrollmentColumns...).
+			Suffix("ON CONFLICT (order_id, course) DO NOTHING").
+			RunWith(tx)
+		for _, e := range enrollmentsForOrder(o) {
+			q = q.Values(e.OrderID, e.Course, e.UserEmail, e.Seats, string(e.Status), e.CreatedAt, nullTime(e.RevokedAt))
+		}
+		_, err := q.ExecContext(ctx)
+		return err
+	case OrderStatusRefunded:
+		_, err := s.sb.Update("enrollments").
+			Set("status", string(EnrollmentStatusRevoked)).
+			Set("revoked_at", o.RefundedAt).
+			Where(sq.Eq{"order_id": o.ID, "status": string(EnrollmentStatusActive)}).
+			RunWith(tx).
+			ExecContext(ctx)
+		return err
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListEnrollments(ctx context.Context, filter EnrollmentFilter) ([]Enrollment, error) {
+	q := s.sb.Select(enrollmentColumns...).
+		From("enrollments").
+		OrderBy("created_at", "course", "order_id")
+	if filter.UserEmail != "" {
+		q = q.Where(sq.Eq{"user_email": filter.UserEmail})
+	}
+	if filter.Course != "" {
+		q = q.Where(sq.Eq{"course": filter.Course})
+	}
+	if filter.Status != "" {
+		q = q.Where(sq.Eq{"status": string(filter.Status)})
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []enrollmentRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	enrollments := make([]Enrollment, 0, len(rows))
+	for _, r := range rows {
+		enrollments = append(enrollments, r.Enrollment())
+	}
+	return enrollments, nil
+}
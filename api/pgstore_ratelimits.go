@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func (s *PostgresStore) TakeRateLimitToken(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Create a full bucket first so there is always a row to lock.
+	_, err = s.sb.Insert("rate_limit_buckets").
+		Columns("key", "tokens", "updated_at").
+		Values(key, float64(limit.Burst), now).
+		Suffix("ON CONFLICT DO NOTHING").
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := s.sb.Select("tokens", "updated_at").
+		From("rate_limit_buckets").
+		Where(sq.Eq{"key": key}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var b RateLimitBucket
+	if err := tx.GetContext(ctx, &b, query, args...); err != nil {
+		return nil, err
+	}
+
+	res := b.Take(limit, now)
+	_, err = s.sb.Update("rate_limit_buckets").
+		Set("tokens", b.Tokens).
+		Set("updated_at", b.UpdatedAt).
+		Where(sq.Eq{"key": key}).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (s *PostgresStore) DeleteRateLimitBuckets(ctx context.Context, before time.Time) error {
+	_, err := s.sb.Delete("rate_limit_buckets").
+		Where(sq.Lt{"updated_at": before}).
+		ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var webhookColumns = []string{"id", "url", "secret", "events", "disabled", "created_at"}
+
+// webhookRow mirrors the webhook_subscriptions table.
+type webhookRow struct {
+	ID        string         `db:"id"`
+	URL       string         `db:"url"`
+	Secret    string         `db:"secret"`
+	Events    pq.StringArray `db:"events"`
+	Disabled  bool           `db:"disabled"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (r webhookRow) Webhook() *WebhookSubscription {
+	events := make([]WebhookEventType, len(r.Events))
+	for i, e := range r.Events {
+		events[i] = WebhookEventType(e)
+	}
+	return &WebhookSubscription{
+		ID:        r.ID,
+		URL:       r.URL,
+		Secret:    r.Secret,
+		Events:    events,
+		Disabled:  r.Disabled,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+var deliveryColumns = []string{
+	"id", "subscription_id", "event_id", "event_type", "payload", "status",
+	"attempts", "next_attempt_at", "created_at", "delivered_at",
+}
+
+// deliveryRow mirrors the webhook_deliveries table.
+type deliveryRow struct {
+	ID             string       `db:"id"`
+	SubscriptionID string       `db:"subscription_id"`
+	EventID        string       `db:"event_id"`
+	EventType      string       `db:"event_type"`
+	Payload        []byte       `db:"payload"`
+	Status         string       `db:"status"`
+	Attempts       int          `db:"attempts"`
+	NextAttemptAt  sql.NullTime `db:"next_attempt_at"`
+	CreatedAt      time.Time    `db:"created_at"`
+	DeliveredAt    sql.NullTime `db:"delivered_at"`
+}
+
+func (r deliveryRow) Delivery() WebhookDelivery {
+	return WebhookDelivery{
+		ID:             r.ID,
+		SubscriptionID: r.SubscriptionID,
+		EventID:        r.EventID,
+		EventType:      WebhookEventType(r.EventType),
+		Payload:        json.RawMessage(r.Payload),
+		Status:         WebhookDeliveryStatus(r.Status),
+		Attempts:       r.Attempts,
+		NextAttemptAt:  r.NextAttemptAt.Time,
+		CreatedAt:      r.CreatedAt,
+		DeliveredAt:    r.DeliveredAt.Time,
+		AttemptLog:     []WebhookAttempt{},
+	}
+}
+
+// attemptRow mirrors the webhook_attempts table.
+type attemptRow struct {
+	DeliveryID string    `db:"delivery_id"`
+	Attempt    int       `db:"attempt"`
+	At         time.Time `db:"at"`
+	StatusCode int       `db:"status_code"`
+	Error      string    `db:"error"`
+}
+
+// enqueueWebhookEvent queues a delivery of the event to every subscription
+// that wants it within tx.
+func (s *PostgresStore) enqueueWebhookEvent(ctx context.Context, tx *sqlx.Tx, t WebhookEventType, o *Order, at time.Time) error {
+	query, args, err := s.sb.Select("id").
+		From("webhook_subscriptions").
+		Where(sq.Eq{"disabled": false}).
+		Where("? = ANY(events)", string(t)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	var ids []string
+	if err := tx.SelectContext(ctx, &ids, query, args...); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	eventID, payload, err := newOrderEvent(t, o, at)
+	if err != nil {
+		return err
+	}
+	q := s.sb.Insert("webhook_deliveries").
+		Columns(deliveryColumns...).
+		RunWith(tx)
+	for _, id := range ids {
+		q = q.Values(uuid.New().String(), id, eventID, string(t), payload, string(WebhookDeliveryPending),
+			0, at, at, nil)
+	}
+	_, err = q.ExecContext(ctx)
+	return err
+}
+
+func (s *PostgresStore) CreateWebhook(ctx context.Context, w *WebhookSubscription) error {
+	events := make(pq.StringArray, len(w.Events))
+	for i, e := range w.Events {
+		events[i] = string(e)
+	}
+	_, err := s.sb.Insert("webhook_subscriptions").
+		Columns(webhookColumns...).
+		Values(w.ID, w.URL, w.Secret, events, w.Disabled, w.CreatedAt).
+		ExecContext(ctx)
+	return err
+}
+
+func (s *PostgresStore) GetWebhook(ctx context.Context, id string) (*WebhookSubscription, error) {
+	query, args, err := s.sb.Select(webhookColumns...).
+		From("webhook_subscriptions").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r webhookRow
+	err = s.db.GetContext(ctx, &r, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.Webhook(), nil
+}
+
+func (s *PostgresStore) ListWebhooks(ctx context.Context) ([]WebhookSubscription, error) {
+	query, args, err := s.sb.Select(webhookColumns...).
+		From("webhook_subscriptions").
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []webhookRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	webhooks := make([]WebhookSubscription, 0, len(rows))
+	for _, r := range rows {
+		webhooks = append(webhooks, *r.Webhook())
+	}
+	return webhooks, nil
+}
+
+func (s *PostgresStore) DisableWebhook(ctx context.Context, id string) error {
+	res, err := s.sb.Update("webhook_subscriptions").
+		Set("disabled", true).
+		Where(sq.Eq{"id": id}).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return expectRows(res, ErrWebhookNotFound)
+}
+
+func (s *PostgresStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	// SKIP LOCKED lets several API replicas claim disjoint batches. The
+	// subquery keeps ? placeholders so the outer query can number them.
+	due, dueArgs, err := sq.Select("id").
+		From("webhook_deliveries").
+		Where(sq.Eq{"status": string(WebhookDeliveryPending)}).
+		Where(sq.LtOrEq{"next_attempt_at": now}).
+		OrderBy("next_attempt_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := s.sb.Update("webhook_deliveries").
+		Set("next_attempt_at", now.Add(lease)).
+		Where(sq.Expr("id IN ("+due+")", dueArgs...)).
+		Suffix("RETURNING " + strings.Join(deliveryColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []deliveryRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	deliveries := make([]WebhookDelivery, 0, len(rows))
+	for _, r := range rows {
+		deliveries = append(deliveries, r.Delivery())
+	}
+	return deliveries, nil
+}
+
+func (s *PostgresStore) RecordWebhookAttempt(ctx context.Context, deliveryID string, attempt WebhookAttempt, status WebhookDeliveryStatus, next time.Time) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = s.sb.Insert("webhook_attempts").
+		Columns("delivery_id", "attempt", "at", "status_code", "error").
+		Values(deliveryID, attempt.Attempt, attempt.At, attempt.StatusCode, attempt.Error).
+		Suffix("ON CONFLICT DO NOTHING").
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	update := s.sb.Update("webhook_deliveries").
+		Set("attempts", attempt.Attempt).
+		Set("status", string(status)).
+		Set("next_attempt_at", nullTime(next)).
+		Where(sq.Eq{"id": deliveryID}).
+		RunWith(tx)
+	if status == WebhookDeliveryDelivered {
+		update = update.Set("delivered_at", attempt.At)
+	}
+	if _, err := update.ExecContext(ctx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ListWebhookDeliveries(ctx context.Context, subscriptionID string, limit int) ([]WebhookDelivery, error) {
+	query, args, err := s.sb.Select(deliveryColumns...).
+		From("webhook_deliveries").
+		Where(sq.Eq{"subscription_id": subscriptionID}).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []deliveryRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []WebhookDelivery{}, nil
+	}
+
+	deliveries := make([]WebhookDelivery, len(rows))
+	index := map[string]int{}
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		deliveries[i] = r.Delivery()
+		index[r.ID] = i
+		ids[i] = r.ID
+	}
+
+	query, args, err = s.sb.Select("delivery_id", "attempt", "at", "status_code", "error").
+		From("webhook_attempts").
+		Where(sq.Eq{"delivery_id": ids}).
+		OrderBy("delivery_id", "attempt").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var attempts []attemptRow
+	if err := s.db.SelectContext(ctx, &attempts, query, args...); err != nil {
+		return nil, err
+	}
+	for _, a := range attempts {
+		d := &deliveries[index[a.DeliveryID]]
+		d.AttemptLog = append(d.AttemptLog, WebhookAttempt{
+			Attempt:    a.Attempt,
+			At:         a.At,
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+		})
+	}
+	return deliveries, nil
+}
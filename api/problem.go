@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const problemContentType = "application/problem+json"
+
+// ErrorCode identifies the kind of an error for programs, independent of
+// the HTTP status and the human readable detail.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest     ErrorCode = "invalid_request"
+	CodeInvalidParameter   ErrorCode = "invalid_parameter"
+	CodeValidationFailed   ErrorCode = "validation_failed"
+	CodeUnauthorized       ErrorCode = "unauthorized"
+	CodeInsufficientScope  ErrorCode = "insufficient_scope"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeRateLimited        ErrorCode = "rate_limited"
+	CodeInternal           ErrorCode = "internal_error"
+	CodePaymentProvider    ErrorCode = "payment_provider_error"
+	CodeInvalidSignature   ErrorCode = "invalid_signature"
+	CodeIdempotencyReused  ErrorCode = "idempotency_key_reused"
+	CodeIdempotencyPending ErrorCode = "idempotency_key_in_progress"
+
+	CodeCourseNotFound        ErrorCode = "course_not_found"
+	CodeCourseExists          ErrorCode = "course_exists"
+	CodeCourseArchived        ErrorCode = "course_archived"
+	CodeCurrencyNotSupported  ErrorCode = "currency_not_supported"
+	CodeOrderNotFound         ErrorCode = "order_not_found"
+	CodeOrderAlreadyPaid      ErrorCode = "order_already_paid"
+	CodeOrderNotPaid          ErrorCode = "order_not_paid"
+	CodeOrderCancelled        ErrorCode = "order_cancelled"
+	CodeOrderExpired          ErrorCode = "order_expired"
+	CodeOrderRefunded         ErrorCode = "order_refunded"
+	CodeCartNotFound          ErrorCode = "cart_not_found"
+	CodeCartCheckedOut        ErrorCode = "cart_checked_out"
+	CodeCouponInvalid         ErrorCode = "coupon_invalid"
+	CodeCouponExpired         ErrorCode = "coupon_expired"
+	CodeCouponExhausted       ErrorCode = "coupon_exhausted"
+	CodeCouponNotApplicable   ErrorCode = "coupon_not_applicable"
+	CodeCouponNotFound        ErrorCode = "coupon_not_found"
+	CodeCouponExists          ErrorCode = "coupon_exists"
+	CodeWebhookNotFound       ErrorCode = "webhook_not_found"
+	CodeAPIKeyNotFound        ErrorCode = "api_key_not_found"
+	CodeCatalogInvalid        ErrorCode = "catalog_invalid"
+	CodeExchangeRatesInvalid  ErrorCode = "exchange_rates_invalid"
+	CodeTaxRatesInvalid       ErrorCode = "tax_rates_invalid"
+	CodeInvalidPaymentEvent   ErrorCode = "invalid_payment_event"
+	CodePaymentSessionInvalid ErrorCode = "payment_session_mismatch"
+)
+
+// Problem is an RFC 7807 problem details body. Code carries the machine
+// readable error code and Errors the invalid fields of a request.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   ErrorCode    `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why one field of a request is invalid. Field is
+// the JSON name of the field, with indexes for list elements such as
+// items[0].quantity.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every invalid field of a request.
+type ValidationErrors []FieldError
+
+func (e *ValidationErrors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Error joins the messages so validation errors can be reported as one
+// line, e.g. when loading a file.
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	if p.Type == "" {
+		p.Type = "/problems/" + string(p.Code)
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	b, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, code ErrorCode, detail string) {
+	writeProblem(w, &Problem{Status: status, Code: code, Detail: detail})
+}
+
+// writeValidationError reports the invalid fields of a request with a 400.
+func writeValidationError(w http.ResponseWriter, errs ValidationErrors) {
+	detail := "Request has invalid fields"
+	if len(errs) == 1 {
+		detail = errs[0].Message
+	}
+	writeProblem(w, &Problem{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: detail,
+		Errors: errs,
+	})
+}
+
+// orderStatusCodes are reported when an order in the status cannot make
+// the requested move.
+var orderStatusCodes = map[OrderStatus]ErrorCode{
+	OrderStatusPending:   CodeOrderNotPaid,
+	OrderStatusPaid:      CodeOrderAlreadyPaid,
+	OrderStatusCancelled: CodeOrderCancelled,
+	OrderStatusExpired:   CodeOrderExpired,
+	OrderStatusRefunded:  CodeOrderRefunded,
+}
+
+// writeTransitionError reports a rejected order status change with a 409
+// and a code naming the order's current status.
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var te *TransitionError
+	switch {
+	case errors.Is(err, ErrOrderExpired):
+		writeError(w, http.StatusConflict, CodeOrderExpired, "Order has expired")
+	case errors.As(err, &te):
+		writeError(w, http.StatusConflict, orderStatusCodes[te.From], fmt.Sprintf("Order is %s and cannot become %s", te.From, te.To))
+	default:
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving order")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrInvalidRateLimits = errors.New("invalid rate limits")
+
+// RateLimit is a token bucket: clients can make Burst requests at once and
+// get PerMinute more every minute.
+type RateLimit struct {
+	PerMinute float64 `json:"per_minute" yaml:"per_minute"`
+	Burst     int     `json:"burst" yaml:"burst"`
+}
+
+// fillTime is how long an empty bucket takes to fill up.
+func (l RateLimit) fillTime() time.Duration {
+	return time.Duration(float64(l.Burst) / l.PerMinute * float64(time.Minute))
+}
+
+// RateLimits holds the limit of every route. Routes are keyed by method
+// and path template, e.g. "POST /carts/{cart}:checkout". Routes without
+// an entry share the Default bucket.
+type RateLimits struct {
+	Default RateLimit            `json:"default" yaml:"default"`
+	Routes  map[string]RateLimit `json:"routes" yaml:"routes"`
+}
+
+// LoadRateLimits reads and validates a rate limit file.
+func LoadRateLimits(path string) (*RateLimits, error) {
+	var limits RateLimits
+	if err := decodeConfigFile(path, &limits); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRateLimits, err)
+	}
+
+	if err := validateRateLimit(limits.Default); err != nil {
+		return nil, fmt.Errorf("%w %s: default: %w", ErrInvalidRateLimits, path, err)
+	}
+	for route, limit := range limits.Routes {
+		if err := validateRateLimit(limit); err != nil {
+			return nil, fmt.Errorf("%w %s: %s: %w", ErrInvalidRateLimits, path, route, err)
+		}
+	}
+	return &limits, nil
+}
+
+func validateRateLimit(l RateLimit) error {
+	if l.PerMinute <= 0 {
+		return errors.New("per_minute must be positive")
+	}
+	if l.Burst < 1 {
+		return errors.New("burst must be at least 1")
+	}
+	return nil
+}
+
+// For returns the limit of the route and the name of its bucket.
+func (l *RateLimits) For(route string) (RateLimit, string) {
+	if limit, ok := l.Routes[route]; ok {
+		return limit, route
+	}
+	return l.Default, "default"
+}
+
+// fillTime is the longest time any bucket takes to fill up. Buckets idle
+// for longer are full and can be forgotten.
+func (l *RateLimits) fillTime() time.Duration {
+	d := l.Default.fillTime()
+	for _, limit := range l.Routes {
+		d = max(d, limit.fillTime())
+	}
+	return d
+}
+
+// RateLimitBucket is the state of one client's bucket for one route.
+type RateLimitBucket struct {
+	Tokens    float64   `db:"tokens"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// RetryAfter is how long until the next token is available.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Take refills the bucket for the time elapsed since it was last updated
+// and takes a token from it if one is available.
+func (b *RateLimitBucket) Take(limit RateLimit, now time.Time) RateLimitResult {
+	perSecond := limit.PerMinute / 60
+	elapsed := max(now.Sub(b.UpdatedAt).Seconds(), 0)
+	b.Tokens = math.Min(float64(limit.Burst), b.Tokens+elapsed*perSecond)
+	b.UpdatedAt = now
+
+	var res RateLimitResult
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.Tokens) / perSecond * float64(time.Second))
+	}
+	res.Remaining = int(b.Tokens)
+	res.ResetAfter = time.Duration((float64(limit.Burst) - b.Tokens) / perSecond * float64(time.Second))
+	return res
+}
+
+// rateLimits returns the currently loaded rate limits, which may be nil
+// when rate limiting is disabled.
+func (s *Server) rateLimits() *RateLimits {
+	s.ratesMu.RLock()
+	defer s.ratesMu.RUnlock()
+	return s.limits
+}
+
+// ReloadRateLimits replaces the rate limits with the content of the
+// configured file. The current limits are kept when the file is invalid.
+func (s *Server) ReloadRateLimits(ctx context.Context) error {
+	if s.Config.RateLimitsPath == "" {
+		return nil
+	}
+	limits, err := LoadRateLimits(s.Config.RateLimitsPath)
+	if err != nil {
+		return err
+	}
+
+	s.ratesMu.Lock()
+	s.limits = limits
+	s.ratesMu.Unlock()
+
+	log.Printf("loaded rate limits for %d routes from %s", len(limits.Routes), s.Config.RateLimitsPath)
+	return nil
+}
+
+// rateLimitClient identifies the caller: its API key when it has one,
+// otherwise its IP address.
+func (s *Server) rateLimitClient(r *http.Request) string {
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	if s.Config.TrustForwardedFor {
+		// Only the last address was added by our proxy; the ones before
+		// it come from the client and can be anything.
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			last := fwd[len(fwd)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return "ip:" + ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit is a router middleware that takes a token from the caller's
+// bucket for the matched route and answers 429 when it is empty. It must
+// run after authenticateRequests so callers with a key are told apart.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := s.rateLimits()
+		if limits == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.Method + " " + r.URL.Path
+		if tmpl, err := mux.CurrentRoute(r).GetPathTemplate(); err == nil {
+			route = r.Method + " " + tmpl
+		}
+		limit, bucket := limits.For(route)
+
+		res, err := s.Store.TakeRateLimitToken(r.Context(), s.rateLimitClient(r)+" "+bucket, limit, s.Clock.Now())
+		if err != nil {
+			// Failing open keeps the API up when the store is struggling.
+			log.Printf("rate limit %s error: %v", route, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			writeError(w, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimitPruner periodically forgets buckets that have been idle long
+// enough to be full again.
+type RateLimitPruner struct {
+	Store RateLimitStore
+	Clock Clock
+	// Limits returns the limits in force, or nil when rate limiting is
+	// disabled.
+	Limits   func() *RateLimits
+	Interval time.Duration
+}
+
+// Run prunes buckets every Interval until ctx is cancelled.
+func (p *RateLimitPruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			limits := p.Limits()
+			if limits == nil {
+				continue
+			}
+			before := p.Clock.Now().Add(-limits.fillTime())
+			if err := p.Store.DeleteRateLimitBuckets(ctx, before); err != nil && ctx.Err() == nil {
+				log.Printf("prune rate limit buckets error: %v", err)
+			}
+		}
+	}
+}
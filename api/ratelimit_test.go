@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		forwarded []string
+		key       *APIKey
+		want      string
+	}{
+		{name: "connection address", want: "ip:192.0.2.1"},
+		{name: "forwarded for ignored", forwarded: []string{"203.0.113.9"}, want: "ip:192.0.2.1"},
+		{name: "proxy address", trust: true, forwarded: []string{"203.0.113.9"}, want: "ip:203.0.113.9"},
+		{name: "client supplied entries", trust: true, forwarded: []string{"198.51.100.7, 203.0.113.9"}, want: "ip:203.0.113.9"},
+		{name: "several headers", trust: true, forwarded: []string{"198.51.100.7", "203.0.113.9"}, want: "ip:203.0.113.9"},
+		{name: "empty entry", trust: true, forwarded: []string{"198.51.100.7, "}, want: "ip:192.0.2.1"},
+		{name: "api key", trust: true, forwarded: []string{"203.0.113.9"}, key: &APIKey{ID: "key1"}, want: "key:key1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Config: &Config{TrustForwardedFor: tt.trust}}
+			r := httptest.NewRequest(http.MethodGet, "/courses", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.key != nil {
+				r = r.WithContext(context.WithValue(context.Background(), apiKeyContextKey{}, tt.key))
+			}
+
+			if got := s.rateLimitClient(r); got != tt.want {
+				t.Errorf("rateLimitClient() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrCourseNotFound = errors.New("course not found")
+	ErrCourseExists   = errors.New("course already exists")
+	ErrOrderNotFound  = errors.New("order not found")
+)
+
+// Store is the persistence layer used by the HTTP handlers.
+type Store interface {
+	CourseStore
+	OrderStore
+	IdempotencyStore
+	CouponStore
+	CartStore
+	EnrollmentStore
+	WebhookStore
+	EmailStore
+	APIKeyStore
+	RateLimitStore
+}
+
+// CourseFilter narrows and orders ListCourses.
+type CourseFilter struct {
+	// Query matches courses whose display name or description contains
+	// it, ignoring case.
+	Query   string
+	OrderBy CourseOrder
+	// After skips every course up to and including the cursor.
+	After *courseCursor
+	Limit int
+}
+
+type CourseStore interface {
+	// ListCourses returns the courses that are not archived.
+	ListCourses(ctx context.Context, filter CourseFilter) ([]Course, error)
+	// GetCourse returns the course even if it is archived so existing
+	// orders can still resolve it.
+	GetCourse(ctx context.Context, name string) (*Course, error)
+	// CreateCourse returns ErrCourseExists when the name is taken,
+	// including by an archived course.
+	CreateCourse(ctx context.Context, course *Course) error
+	UpdateCourse(ctx context.Context, course *Course) error
+	ArchiveCourse(ctx context.Context, name string) error
+}
+
+// OrderFilter narrows ListOrders. Zero values match every order.
+type OrderFilter struct {
+	UserEmail    string
+	Status       OrderStatus
+	Course       string
+	CreatedAfter time.Time
+	// ExpiresBefore matches orders whose payment window ends before it.
+	ExpiresBefore time.Time
+	// After skips every order up to and including the cursor.
+	After *orderCursor
+	Limit int
+}
+
+type OrderStore interface {
+	// CreateOrder saves a new order. When the order uses a coupon, the
+	// coupon redemption is counted in the same step and ErrCouponExhausted
+	// is returned if its usage limit has been reached in the meantime. An
+	// order.created webhook event is queued with the order.
+	CreateOrder(ctx context.Context, order *Order) error
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	// ListOrders returns the orders matching the filter sorted by
+	// CreatedAt and then ID.
+	ListOrders(ctx context.Context, filter OrderFilter) ([]Order, error)
+	// TransitionOrder atomically moves the order to the given status. It
+	// returns ErrInvalidOrderTransition when the current status does not
+	// allow it. Paying an order enrolls the buyer in its courses and
+	// refunding it revokes those enrollments in the same step, cancelling
+	// it gives back its coupon redemption, and the matching webhook event
+	// is queued.
+	TransitionOrder(ctx context.Context, id string, to OrderStatus, at time.Time) (*Order, error)
+	// ExpireOrders marks every pending order whose payment window ended
+	// at or before now as expired, gives back their coupon redemptions and
+	// returns them.
+	ExpireOrders(ctx context.Context, now time.Time) ([]Order, error)
+}
+
+type IdempotencyStore interface {
+	// CreateIdempotencyRecord reserves the key. It returns
+	// ErrIdempotencyKeyExists when the key is already taken in the scope.
+	CreateIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord) error
+	GetIdempotencyRecord(ctx context.Context, scope, key string) (*IdempotencyRecord, error)
+	CompleteIdempotencyRecord(ctx context.Context, scope, key string, statusCode int, body []byte) error
+	DeleteIdempotencyRecord(ctx context.Context, scope, key string) error
+	// ReclaimIdempotencyRecord replaces an expired or abandoned record
+	// with rec, provided it was still created at createdAt. It returns
+	// ErrIdempotencyKeyExists when another request reclaimed it first.
+	ReclaimIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord, createdAt time.Time) error
+	// DeleteIdempotencyRecords forgets records created before the given
+	// time.
+	DeleteIdempotencyRecords(ctx context.Context, before time.Time) error
+}
+
+type CouponStore interface {
+	// CreateCoupon returns ErrCouponExists when the code is taken.
+	CreateCoupon(ctx context.Context, coupon *Coupon) error
+	GetCoupon(ctx context.Context, code string) (*Coupon, error)
+	ListCoupons(ctx context.Context) ([]Coupon, error)
+	DisableCoupon(ctx context.Context, code string) error
+}
+
+type CartStore interface {
+	CreateCart(ctx context.Context, cart *Cart) error
+	GetCart(ctx context.Context, id string) (*Cart, error)
+	// UpdateCart returns ErrCartCheckedOut when the cart has already been
+	// checked out.
+	UpdateCart(ctx context.Context, cart *Cart) error
+	// CheckoutCart saves the order like CreateOrder and marks the cart as
+	// checked out by it in the same step. It returns ErrCartCheckedOut
+	// when the cart already has an order.
+	CheckoutCart(ctx context.Context, cartID string, order *Order) error
+}
+
+// EnrollmentFilter narrows ListEnrollments. Zero values match every
+// enrollment.
+type EnrollmentFilter struct {
+	UserEmail string
+	Course    string
+	Status    EnrollmentStatus
+}
+
+type EnrollmentStore interface {
+	// ListEnrollments returns the enrollments matching the filter sorted
+	// by CreatedAt, then course and order.
+	ListEnrollments(ctx context.Context, filter EnrollmentFilter) ([]Enrollment, error)
+}
+
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook *WebhookSubscription) error
+	GetWebhook(ctx context.Context, id string) (*WebhookSubscription, error)
+	ListWebhooks(ctx context.Context) ([]WebhookSubscription, error)
+	DisableWebhook(ctx context.Context, id string) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at
+	// now and hides them from other callers for lease.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// RecordWebhookAttempt appends the attempt to the delivery and moves it
+	// to status. Pending deliveries are retried at next.
+	RecordWebhookAttempt(ctx context.Context, deliveryID string, attempt WebhookAttempt, status WebhookDeliveryStatus, next time.Time) error
+	// ListWebhookDeliveries returns the latest deliveries of the
+	// subscription, newest first.
+	ListWebhookDeliveries(ctx context.Context, subscriptionID string, limit int) ([]WebhookDelivery, error)
+}
+
+type EmailStore interface {
+	// EnqueueEmail adds the email to the outbox. It returns ErrEmailExists
+	// when an email with the same ID was queued before.
+	EnqueueEmail(ctx context.Context, email *Email) error
+	// ClaimEmails returns up to limit pending emails due at now and hides
+	// them from other callers for lease.
+	ClaimEmails(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Email, error)
+	// RecordEmailAttempt stores the outcome of a send attempt. at is when
+	// the email was sent, or when a pending email is retried.
+	RecordEmailAttempt(ctx context.Context, id string, attempts int, lastError string, status EmailStatus, at time.Time) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	// GetAPIKeyByHash returns the key with the given hash, including
+	// revoked keys.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	// ListAPIKeys returns every key, oldest first.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey marks the key revoked at the given time. Revoking a key
+	// twice keeps the first time.
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+type RateLimitStore interface {
+	// TakeRateLimitToken takes a token from the bucket with the given key,
+	// creating a full bucket if there is none. Concurrent callers, also on
+	// other replicas, never share a token.
+	TakeRateLimitToken(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error)
+	// DeleteRateLimitBuckets forgets buckets last used before the given
+	// time.
+	DeleteRateLimitBuckets(ctx context.Context, before time.Time) error
+}
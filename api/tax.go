@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+var ErrInvalidTaxRates = errors.New("invalid tax rates")
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// TaxRate is the sales tax charged to buyers in a country.
+type TaxRate struct {
+	// Name is shown to the buyer, e.g. "VAT" or "GST".
+	Name string `json:"name" yaml:"name"`
+	// Rate is the fraction of the subtotal charged as tax, e.g. 0.19.
+	Rate float64 `json:"rate" yaml:"rate"`
+}
+
+// TaxTable holds the tax rates by ISO 3166-1 alpha-2 country code.
+// Countries without an entry are not taxed.
+type TaxTable struct {
+	Countries map[string]TaxRate `json:"countries" yaml:"countries"`
+}
+
+// LoadTaxTable reads and validates a tax rate file.
+func LoadTaxTable(path string) (*TaxTable, error) {
+	var table TaxTable
+	if err := decodeConfigFile(path, &table); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTaxRates, err)
+	}
+
+	for country, rate := range table.Countries {
+		if !countryCodePattern.MatchString(country) {
+			return nil, fmt.Errorf("%w %s: %q is not an ISO 3166 country code", ErrInvalidTaxRates, path, country)
+		}
+		if rate.Rate < 0 || rate.Rate >= 1 {
+			return nil, fmt.Errorf("%w %s: rate for %s must be between 0 and 1", ErrInvalidTaxRates, path, country)
+		}
+	}
+	return &table, nil
+}
+
+// Rate returns the tax rate for the country. The zero TaxRate is returned
+// for countries that are not taxed.
+func (t *TaxTable) Rate(country string) TaxRate {
+	if t == nil {
+		return TaxRate{}
+	}
+	return t.Countries[country]
+}
+
+// ApplyTax computes the subtotal, tax and total of the order from its
+// original price and discount for a buyer in the given country. Price is
+// set to the total, which is what the buyer is charged.
+func (o *Order) ApplyTax(country string, taxes *TaxTable) {
+	rate := taxes.Rate(country)
+
+	o.Country = country
+	o.Subtotal = roundCurrency(o.OriginalPrice-o.Discount, o.Currency)
+	o.TaxName = rate.Name
+	o.TaxRate = rate.Rate
+	o.Tax = roundCurrency(o.Subtotal*rate.Rate, o.Currency)
+	o.Total = roundCurrency(o.Subtotal+o.Tax, o.Currency)
+	o.Price = o.Total
+}
+
+// taxTable returns the currently loaded tax rates, which may be nil when
+// no tax rate file is configured.
+func (s *Server) taxTable() *TaxTable {
+	s.ratesMu.RLock()
+	defer s.ratesMu.RUnlock()
+	return s.taxes
+}
+
+// ReloadTaxTable replaces the tax rates with the content of the configured
+// file. The current rates are kept when the file is invalid.
+func (s *Server) ReloadTaxTable(ctx context.Context) error {
+	if s.Config.TaxRatesPath == "" {
+		return nil
+	}
+	table, err := LoadTaxTable(s.Config.TaxRatesPath)
+	if err != nil {
+		return err
+	}
+
+	s.ratesMu.Lock()
+	s.taxes = table
+	s.ratesMu.Unlock()
+
+	log.Printf("loaded tax rates for %d countries from %s", len(table.Countries), s.Config.TaxRatesPath)
+	return nil
+}
+
+func (s *Server) ReloadTaxTableHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := s.ReloadTaxTable(r.Context())
+	if errors.Is(err, ErrInvalidTaxRates) {
+		writeError(w, http.StatusUnprocessableEntity, CodeTaxRatesInvalid, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error loading tax rates")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookSignatureHeader = "Webhook-Signature"
+	webhookIDHeader        = "Webhook-Id"
+	webhookEventHeader     = "Webhook-Event"
+
+	// webhookBatchSize is how many deliveries a worker claims per pass and
+	// webhookTimeout how long a single post may take. webhookLease, how
+	// long the deliveries stay claimed before another worker may retry
+	// them, covers a batch of posts that all time out plus a margin for
+	// recording the attempts, so a slow batch is never sent twice.
+	webhookBatchSize = 10
+	webhookTimeout   = 10 * time.Second
+	webhookLease     = webhookBatchSize*webhookTimeout + time.Minute
+
+	retryBaseBackoff = 30 * time.Second
+	retryMaxBackoff  = time.Hour
+)
+
+// WebhookDispatcher sends the deliveries waiting in the outbox. Failed
+// deliveries are retried with exponential backoff until MaxAttempts is
+// reached. Several dispatchers may share a store; each delivery is
+// claimed by one of them at a time.
+type WebhookDispatcher struct {
+	Store       WebhookStore
+	Clock       Clock
+	Client      *http.Client
+	Interval    time.Duration
+	MaxAttempts int
+}
+
+// Run delivers due webhooks every Interval until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DeliverOnce(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("deliver webhooks error: %v", err)
+			}
+		}
+	}
+}
+
+// DeliverOnce claims the deliveries that are due, tries each of them once
+// and returns how many it tried.
+func (d *WebhookDispatcher) DeliverOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.Store.ClaimWebhookDeliveries(ctx, d.Clock.Now(), webhookLease, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := map[string]*WebhookSubscription{}
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.SubscriptionID]
+		if !ok {
+			webhook, err = d.Store.GetWebhook(ctx, delivery.SubscriptionID)
+			if err != nil {
+				return 0, err
+			}
+			webhooks[delivery.SubscriptionID] = webhook
+		}
+		if err := d.deliver(ctx, webhook, &delivery); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// deliver makes one attempt and records its outcome.
+func (d *WebhookDispatcher) deliver(ctx context.Context, webhook *WebhookSubscription, delivery *WebhookDelivery) error {
+	now := d.Clock.Now()
+	attempt := WebhookAttempt{Attempt: delivery.Attempts + 1, At: now}
+
+	if webhook.Disabled {
+		attempt.Error = "webhook disabled"
+		return d.Store.RecordWebhookAttempt(ctx, delivery.ID, attempt, WebhookDeliveryFailed, time.Time{})
+	}
+
+	attempt.StatusCode, attempt.Error = d.post(ctx, webhook, delivery, now)
+	if attempt.Error == "" {
+		return d.Store.RecordWebhookAttempt(ctx, delivery.ID, attempt, WebhookDeliveryDelivered, time.Time{})
+	}
+
+	log.Printf("webhook delivery %s to %s failed (attempt %d): %s", delivery.ID, webhook.URL, attempt.Attempt, attempt.Error)
+	if attempt.Attempt >= d.MaxAttempts {
+		return d.Store.RecordWebhookAttempt(ctx, delivery.ID, attempt, WebhookDeliveryFailed, time.Time{})
+	}
+	next := now.Add(retryBackoff(attempt.Attempt))
+	return d.Store.RecordWebhookAttempt(ctx, delivery.ID, attempt, WebhookDeliveryPending, next)
+}
+
+// post sends the signed payload and returns the response status and, when
+// the attempt failed, why.
+func (d *WebhookDispatcher) post(ctx context.Context, webhook *WebhookSubscription, delivery *WebhookDelivery, now time.Time) (int, string) {
+	// Bound the post here rather than relying on the client, the lease
+	// depends on it.
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookIDHeader, delivery.EventID)
+	req.Header.Set(webhookEventHeader, string(delivery.EventType))
+	// Subscribers verify events the same way we verify payment webhooks.
+	req.Header.Set(webhookSignatureHeader, signPayment([]byte(webhook.Secret), delivery.Payload, now))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, ""
+}
+
+// retryBackoff returns how long to wait after the given failed attempt:
+// 30s, 1m, 2m, ... capped at an hour.
+func retryBackoff(attempt int) time.Duration {
+	backoff := retryBaseBackoff
+	for i := 1; i < attempt && backoff < retryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, retryMaxBackoff)
+}
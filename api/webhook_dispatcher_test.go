@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is an httptest.Server that records the requests it gets
+// and answers with the next status in statuses, repeating the last one.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	rcv := &webhookReceiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read webhook body: %v", err)
+		}
+
+		rcv.mu.Lock()
+		rcv.requests = append(rcv.requests, receivedWebhook{header: r.Header.Clone(), body: body})
+		status := rcv.statuses[min(len(rcv.requests), len(rcv.statuses))-1]
+		rcv.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *webhookReceiver) received() []receivedWebhook {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return slices.Clone(rcv.requests)
+}
+
+// newWebhookTest subscribes a webhook pointing at rcv to order.created,
+// creates an order so one delivery is queued and returns a dispatcher for
+// it.
+func newWebhookTest(t *testing.T, rcv *webhookReceiver, maxAttempts int) (*WebhookDispatcher, *MemoryStore, *fakeClock, *WebhookSubscription) {
+	t.Helper()
+	ctx := context.Background()
+	clock := newFakeClock(time.Now().Truncate(time.Second))
+	store := NewMemoryStore()
+
+	webhook := &WebhookSubscription{
+		ID:        "webhook",
+		URL:       rcv.URL,
+		Secret:    "whsec_test",
+		Events:    []WebhookEventType{WebhookEventOrderCreated},
+		CreatedAt: clock.Now(),
+	}
+	if err := store.CreateWebhook(ctx, webhook); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	order := &Order{ID: "order", Status: OrderStatusPending, CreatedAt: clock.Now()}
+	if err := store.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	dispatcher := &WebhookDispatcher{
+		Store:       store,
+		Clock:       clock,
+		Client:      rcv.Client(),
+		Interval:    time.Second,
+		MaxAttempts: maxAttempts,
+	}
+	return dispatcher, store, clock, webhook
+}
+
+func onlyDelivery(t *testing.T, store *MemoryStore, webhookID string) WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.ListWebhookDeliveries(context.Background(), webhookID, 10)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestWebhookDispatcherSignsDeliveries(t *testing.T) {
+	rcv := newWebhookReceiver(t, http.StatusNoContent)
+	dispatcher, store, clock, webhook := newWebhookTest(t, rcv, 3)
+
+	n, err := dispatcher.DeliverOnce(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverOnce: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("DeliverOnce tried %d deliveries, want 1", n)
+	}
+
+	reqs := rcv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	delivery := onlyDelivery(t, store, webhook.ID)
+
+	if got := string(req.body); got != string(delivery.Payload) {
+		t.Errorf("body = %s, want %s", got, delivery.Payload)
+	}
+	if got := req.header.Get(webhookIDHeader); got != delivery.EventID {
+		t.Errorf("%s = %q, want %q", webhookIDHeader, got, delivery.EventID)
+	}
+	if got := req.header.Get(webhookEventHeader); got != string(WebhookEventOrderCreated) {
+		t.Errorf("%s = %q, want %q", webhookEventHeader, got, WebhookEventOrderCreated)
+	}
+
+	sig := req.header.Get(webhookSignatureHeader)
+	if err := verifyPaymentSignature([]byte(webhook.Secret), req.body, sig, clock.Now()); err != nil {
+		t.Errorf("signature %q does not verify: %v", sig, err)
+	}
+	if err := verifyPaymentSignature([]byte("other secret"), req.body, sig, clock.Now()); !errors.Is(err, ErrInvalidPaymentSignature) {
+		t.Errorf("signature verified with the wrong secret: %v", err)
+	}
+	tampered := append(slices.Clone(req.body), ' ')
+	if err := verifyPaymentSignature([]byte(webhook.Secret), tampered, sig, clock.Now()); !errors.Is(err, ErrInvalidPaymentSignature) {
+		t.Errorf("signature verified a tampered body: %v", err)
+	}
+
+	if delivery.Status != WebhookDeliveryDelivered {
+		t.Errorf("status = %s, want %s", delivery.Status, WebhookDeliveryDelivered)
+	}
+	if !delivery.DeliveredAt.Equal(clock.Now()) {
+		t.Errorf("delivered_at = %v, want %v", delivery.DeliveredAt, clock.Now())
+	}
+}
+
+func TestWebhookDispatcherRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	dispatcher, store, clock, webhook := newWebhookTest(t, rcv, 5)
+
+	steps := []struct {
+		advance    time.Duration
+		wantTried  int
+		wantStatus WebhookDeliveryStatus
+	}{
+		{advance: 0, wantTried: 1, wantStatus: WebhookDeliveryPending},
+		// Not due before the first backoff of 30s has passed.
+		{advance: 29 * time.Second, wantTried: 0, wantStatus: WebhookDeliveryPending},
+		{advance: time.Second, wantTried: 1, wantStatus: WebhookDeliveryPending},
+		{advance: 59 * time.Second, wantTried: 0, wantStatus: WebhookDeliveryPending},
+		{advance: time.Second, wantTried: 1, wantStatus: WebhookDeliveryDelivered},
+		{advance: time.Hour, wantTried: 0, wantStatus: WebhookDeliveryDelivered},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		tried, err := dispatcher.DeliverOnce(ctx)
+		if err != nil {
+			t.Fatalf("step %d: DeliverOnce: %v", i, err)
+		}
+		if tried != step.wantTried {
+			t.Errorf("step %d: tried %d deliveries, want %d", i, tried, step.wantTried)
+		}
+		if got := onlyDelivery(t, store, webhook.ID).Status; got != step.wantStatus {
+			t.Errorf("step %d: status = %s, want %s", i, got, step.wantStatus)
+		}
+	}
+
+	delivery := onlyDelivery(t, store, webhook.ID)
+	if delivery.Attempts != 3 {
+		t.Errorf("attempts = %d, want 3", delivery.Attempts)
+	}
+	var codes []int
+	for _, a := range delivery.AttemptLog {
+		codes = append(codes, a.StatusCode)
+	}
+	if want := []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}; !slices.Equal(codes, want) {
+		t.Errorf("attempt status codes = %v, want %v", codes, want)
+	}
+	if len(rcv.received()) != 3 {
+		t.Errorf("receiver got %d requests, want 3", len(rcv.received()))
+	}
+}
+
+func TestWebhookDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusServiceUnavailable)
+	dispatcher, store, clock, webhook := newWebhookTest(t, rcv, 2)
+
+	for i := 0; i < 4; i++ {
+		if _, err := dispatcher.DeliverOnce(ctx); err != nil {
+			t.Fatalf("DeliverOnce: %v", err)
+		}
+		clock.Advance(retryMaxBackoff)
+	}
+
+	delivery := onlyDelivery(t, store, webhook.ID)
+	if delivery.Status != WebhookDeliveryFailed {
+		t.Errorf("status = %s, want %s", delivery.Status, WebhookDeliveryFailed)
+	}
+	if delivery.Attempts != 2 {
+		t.Errorf("attempts = %d, want 2", delivery.Attempts)
+	}
+	if len(rcv.received()) != 2 {
+		t.Errorf("receiver got %d requests, want 2", len(rcv.received()))
+	}
+	if got := delivery.AttemptLog[1].Error; got != "unexpected status 503" {
+		t.Errorf("last attempt error = %q, want %q", got, "unexpected status 503")
+	}
+}
+
+func TestWebhookDispatcherSkipsDisabledWebhooks(t *testing.T) {
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusOK)
+	dispatcher, store, _, webhook := newWebhookTest(t, rcv, 5)
+
+	if err := store.DisableWebhook(ctx, webhook.ID); err != nil {
+		t.Fatalf("DisableWebhook: %v", err)
+	}
+	if _, err := dispatcher.DeliverOnce(ctx); err != nil {
+		t.Fatalf("DeliverOnce: %v", err)
+	}
+
+	if got := onlyDelivery(t, store, webhook.ID).Status; got != WebhookDeliveryFailed {
+		t.Errorf("status = %s, want %s", got, WebhookDeliveryFailed)
+	}
+	if len(rcv.received()) != 0 {
+		t.Errorf("receiver got %d requests, want none", len(rcv.received()))
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: time.Minute},
+		{attempt: 3, want: 2 * time.Minute},
+		{attempt: 7, want: 32 * time.Minute},
+		{attempt: 8, want: time.Hour},
+		{attempt: 50, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempt); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type WebhookEventType string
+
+const (
+	WebhookEventOrderCreated  WebhookEventType = "order.created"
+	WebhookEventOrderPaid     WebhookEventType = "order.paid"
+	WebhookEventOrderRefunded WebhookEventType = "order.refunded"
+)
+
+var webhookEventTypes = []WebhookEventType{
+	WebhookEventOrderCreated,
+	WebhookEventOrderPaid,
+	WebhookEventOrderRefunded,
+}
+
+// orderStatusEvents maps order statuses to the event sent when an order
+// enters them.
+var orderStatusEvents = map[OrderStatus]WebhookEventType{
+	OrderStatusPaid:     WebhookEventOrderPaid,
+	OrderStatusRefunded: WebhookEventOrderRefunded,
+}
+
+// WebhookSubscription asks for events of the given types to be POSTed to
+// URL, signed with Secret.
+type WebhookSubscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret is only returned when the subscription is created.
+	Secret    string             `json:"secret,omitempty"`
+	Events    []WebhookEventType `json:"events"`
+	Disabled  bool               `json:"disabled"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// Subscribes reports whether the subscription wants events of type t.
+func (w *WebhookSubscription) Subscribes(t WebhookEventType) bool {
+	return !w.Disabled && slices.Contains(w.Events, t)
+}
+
+// WebhookEvent is the JSON body delivered to subscribers.
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      interface{}      `json:"data"`
+}
+
+// newOrderEvent builds the payload of an order event.
+func newOrderEvent(t WebhookEventType, o *Order, at time.Time) (id string, payload []byte, err error) {
+	id = uuid.New().String()
+	payload, err = json.Marshal(WebhookEvent{
+		ID:        id,
+		Type:      t,
+		CreatedAt: at,
+		Data:      o,
+	})
+	return id, payload, err
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event waiting in the outbox for, or already
+// delivered to, one subscription.
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	SubscriptionID string                `json:"subscription_id"`
+	EventID        string                `json:"event_id"`
+	EventType      WebhookEventType      `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	CreatedAt      time.Time             `json:"created_at"`
+	DeliveredAt    time.Time             `json:"delivered_at"`
+	// AttemptLog lists every delivery attempt, oldest first.
+	AttemptLog []WebhookAttempt `json:"attempt_log"`
+}
+
+// WebhookAttempt records one try to deliver an event.
+type WebhookAttempt struct {
+	Attempt    int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func validateWebhook(w *WebhookSubscription) ValidationErrors {
+	var errs ValidationErrors
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "Webhook url must be an absolute http or https URL")
+	}
+	if len(w.Events) == 0 {
+		errs.Add("events", "Webhook must subscribe to at least one event")
+	}
+	for i, t := range w.Events {
+		if !slices.Contains(webhookEventTypes, t) {
+			errs.Add(fmt.Sprintf("events[%d]", i), "Unknown webhook event "+string(t))
+		}
+	}
+	return errs
+}
+
+// newWebhookSecret returns a random signing secret.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// CreateWebhookHandler registers a subscription. A secret is generated
+// when none is given; either way it is only returned in this response.
+func (s *Server) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var webhook WebhookSubscription
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	webhook.ID = uuid.New().String()
+	webhook.Disabled = false
+	webhook.CreatedAt = s.Clock.Now()
+	if errs := validateWebhook(&webhook); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+	if webhook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "Error generating secret")
+			return
+		}
+		webhook.Secret = secret
+	}
+
+	if err := s.Store.CreateWebhook(r.Context(), &webhook); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving webhook")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(webhook)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	webhooks, err := s.Store.ListWebhooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading webhooks")
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	jsonResponse, err := json.Marshal(map[string]interface{}{"webhooks": webhooks})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	webhook, ok := s.getWebhook(w, r)
+	if !ok {
+		return
+	}
+	webhook.Secret = ""
+
+	jsonResponse, err := json.Marshal(webhook)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// DisableWebhookHandler stops new events from being sent to the
+// subscription. Pending deliveries are given up.
+func (s *Server) DisableWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	err := s.Store.DisableWebhook(r.Context(), vars["webhook"])
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, CodeWebhookNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveriesHandler lists the most recent deliveries of a
+// subscription, newest first, with their attempts. page_size limits how
+// many are returned.
+func (s *Server) ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	pageSize, err := parsePageSize(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	webhook, ok := s.getWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := s.Store.ListWebhookDeliveries(r.Context(), webhook.ID, pageSize)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading deliveries")
+		return
+	}
+
+	jsonResponse, err := json.Marshal(map[string]interface{}{"deliveries": deliveries})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding JSON")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func (s *Server) getWebhook(w http.ResponseWriter, r *http.Request) (*WebhookSubscription, bool) {
+	vars := mux.Vars(r)
+	webhook, err := s.Store.GetWebhook(r.Context(), vars["webhook"])
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, CodeWebhookNotFound, "Webhook not found")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error reading webhook")
+		return nil, false
+	}
+	return webhook, true
+}
@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -15,121 +16,223 @@ type Course struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	Currency    string  `json:"currency"`
+
+	// Prices holds explicit prices in other currencies, keyed by ISO 4217
+	// code.
+	Prices map[string]float64 `json:"prices,omitempty"`
 }
 
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusExpired   OrderStatus = "expired"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
 type Order struct {
-	ID        string    `json:"id"`
-	Course    string    `json:"course"`
-	Price     float64   `json:"price"`
-	Currency  string    `json:"currency"`
-	UserEmail string    `json:"user_email"`
-	UserName  string    `json:"user_name"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	PaidAt    time.Time `json:"paid_at"`
+	ID          string      `json:"id"`
+	Course      string      `json:"course"`
+	Price       float64     `json:"price"`
+	Currency    string      `json:"currency"`
+	UserEmail   string      `json:"user_email"`
+	UserName    string      `json:"user_name"`
+	Status      OrderStatus `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	PaidAt      time.Time   `json:"paid_at"`
+	CancelledAt time.Time   `json:"cancelled_at"`
+	ExpiredAt   time.Time   `json:"expired_at"`
+	RefundedAt  time.Time   `json:"refunded_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	PaymentURL  string      `json:"payment_url"`
+
+	OriginalPrice float64 `json:"original_price"`
+	Discount      float64 `json:"discount"`
+	CouponCode    string  `json:"coupon_code,omitempty"`
+
+	Country  string  `json:"country"`
+	Subtotal float64 `json:"subtotal"`
+	TaxName  string  `json:"tax_name,omitempty"`
+	TaxRate  float64 `json:"tax_rate"`
+	Tax      float64 `json:"tax"`
+	Total    float64 `json:"total"`
+
+	Items []OrderItem `json:"items"`
 }
 
-func ListCourse(ctx context.Context) ([]Course, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8080/courses", nil)
-	if err != nil {
-		return nil, err
+// OrderItem is a course in an order and the number of seats bought.
+type OrderItem struct {
+	Course      string  `json:"course"`
+	DisplayName string  `json:"display_name,omitempty"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+// ListCourse lists the courses in the catalog. When query is not empty
+// only courses whose name or description contain it are returned.
+func ListCourse(ctx context.Context, query string) ([]Course, error) {
+	q := url.Values{}
+	if query != "" {
+		q.Set("q", query)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	req, err := newRequest(ctx, http.MethodGet, "/courses?"+q.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	type response struct {
+		Courses []Course `json:"courses"`
 	}
-	var courses []Course
-	err = json.Unmarshal(body, &courses)
-	if err != nil {
+	var courses response
+	if err := do(req, &courses); err != nil {
 		return nil, err
 	}
-	return courses, nil
+	return courses.Courses, nil
 }
 
 func GetCourse(ctx context.Context, course string) (*Course, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8080/courses/"+course, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	req, err := newRequest(ctx, http.MethodGet, "/courses/"+url.PathEscape(course), nil)
 	if err != nil {
 		return nil, err
 	}
 	var courses Course
-	err = json.Unmarshal(body, &courses)
-	if err != nil {
+	if err := do(req, &courses); err != nil {
 		return nil, err
 	}
 	return &courses, nil
 }
 
-func CreateOrder(ctx context.Context, course, userName, userEmail string) (*Order, error) {
-	type payload struct {
-		Course    string `json:"course"`
-		UserName  string `json:"user_name"`
-		UserEmail string `json:"user_email"`
-	}
-	p := payload{
-		Course:    course,
-		UserName:  userName,
-		UserEmail: userEmail,
-	}
+type CreateOrderRequest struct {
+	Course     string `json:"course"`
+	Quantity   int    `json:"quantity,omitempty"`
+	UserName   string `json:"user_name"`
+	UserEmail  string `json:"user_email"`
+	CouponCode string `json:"coupon_code,omitempty"`
+	// Currency is the ISO 4217 code the order is charged in. The course
+	// currency is used when it is empty.
+	Currency string `json:"currency,omitempty"`
+	// Country is the buyer's ISO 3166-1 alpha-2 country, used to compute
+	// tax.
+	Country string `json:"country"`
+}
+
+// CreateOrder creates an order for the course. When idempotencyKey is not
+// empty it is sent as the Idempotency-Key header so a retried call does not
+// create a second order.
+func CreateOrder(ctx context.Context, p CreateOrderRequest, idempotencyKey string) (*Order, error) {
 	pb, err := json.Marshal(p)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:8080/orders", bytes.NewReader(pb))
+	req, err := newRequest(ctx, http.MethodPost, "/orders", bytes.NewReader(pb))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	type response struct {
+		OrderID string `json:"order_id"`
+	}
+	var created response
+	if err := do(req, &created); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	return GetOrder(ctx, created.OrderID)
+}
+
+func GetOrder(ctx context.Context, orderNumber string) (*Order, error) {
+	req, err := newRequest(ctx, http.MethodGet, "/orders/"+url.PathEscape(orderNumber), nil)
 	if err != nil {
 		return nil, err
 	}
-
 	var order Order
-	err = json.Unmarshal(body, &order)
-	if err != nil {
+	if err := do(req, &order); err != nil {
 		return nil, err
 	}
 	return &order, nil
 }
 
-func GetOrder(ctx context.Context, orderNumber string) (*Order, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8080/orders/"+orderNumber, nil)
+type ListOrdersOptions struct {
+	UserEmail    string
+	Status       OrderStatus
+	Course       string
+	CreatedAfter time.Time
+	PageSize     int
+	PageToken    string
+}
+
+type ListOrdersResponse struct {
+	Orders        []Order `json:"orders"`
+	NextPageToken string  `json:"next_page_token"`
+}
+
+func ListOrders(ctx context.Context, opts ListOrdersOptions) (*ListOrdersResponse, error) {
+	q := url.Values{}
+	if opts.UserEmail != "" {
+		q.Set("user_email", opts.UserEmail)
+	}
+	if opts.Status != "" {
+		q.Set("status", string(opts.Status))
+	}
+	if opts.Course != "" {
+		q.Set("course", opts.Course)
+	}
+	if !opts.CreatedAfter.IsZero() {
+		q.Set("created_after", opts.CreatedAfter.Format(time.RFC3339))
+	}
+	if opts.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(opts.PageSize))
+	}
+	if opts.PageToken != "" {
+		q.Set("page_token", opts.PageToken)
+	}
+
+	req, err := newRequest(ctx, http.MethodGet, "/orders?"+q.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	var orders ListOrdersResponse
+	if err := do(req, &orders); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	return &orders, nil
+}
+
+type EnrollmentStatus string
+
+const (
+	EnrollmentStatusActive  EnrollmentStatus = "active"
+	EnrollmentStatusRevoked EnrollmentStatus = "revoked"
+)
+
+// Enrollment grants a user access to a course bought on an order.
+type Enrollment struct {
+	UserEmail string           `json:"user_email"`
+	Course    string           `json:"course"`
+	OrderID   string           `json:"order_id"`
+	Seats     int              `json:"seats"`
+	Status    EnrollmentStatus `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
+	RevokedAt time.Time        `json:"revoked_at"`
+}
+
+// ListEnrollments lists the active enrollments of the user.
+func ListEnrollments(ctx context.Context, userEmail string) ([]Enrollment, error) {
+	req, err := newRequest(ctx, http.MethodGet, "/users/"+url.PathEscape(userEmail)+"/enrollments", nil)
 	if err != nil {
 		return nil, err
 	}
-	var order Order
-	err = json.Unmarshal(body, &order)
-	if err != nil {
+	var res struct {
+		Enrollments []Enrollment `json:"enrollments"`
+	}
+	if err := do(req, &res); err != nil {
 		return nil, err
 	}
-	return &order, nil
+	return res.Enrollments, nil
 }
@@ -0,0 +1,53 @@
+package courses
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Config tells the client where the course API is and how to
+// authenticate with it.
+type Config struct {
+	// BaseURL is the URL of the course API, without a trailing slash.
+	BaseURL string
+	// APIKey is sent as a bearer token. It needs the courses:read,
+	// orders:read, orders:write and enrollments:read scopes, which let
+	// it read the orders and enrollments of every user.
+	APIKey string
+}
+
+var config = Config{BaseURL: "http://localhost:8080"}
+
+// ConfigFromEnv reads the config from COURSES_API_URL and
+// COURSES_API_KEY.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		BaseURL: strings.TrimSuffix(os.Getenv("COURSES_API_URL"), "/"),
+		APIKey:  os.Getenv("COURSES_API_KEY"),
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:8080"
+	}
+	return cfg
+}
+
+// Configure sets the config used by every call of the package. It must be
+// called before the client is used.
+func Configure(cfg Config) {
+	config = cfg
+}
+
+// newRequest builds an authenticated request to path on the course API.
+func newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, config.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
+	return req, nil
+}
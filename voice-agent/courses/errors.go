@@ -0,0 +1,40 @@
+package courses
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"voice-agent/problem"
+)
+
+// Errors returned by the client match these with errors.Is. The returned
+// error is a *problem.Problem carrying the API's detail and field errors.
+var (
+	ErrCourseNotFound       = &problem.Problem{Code: problem.CodeCourseNotFound}
+	ErrCourseArchived       = &problem.Problem{Code: problem.CodeCourseArchived}
+	ErrCurrencyNotSupported = &problem.Problem{Code: problem.CodeCurrencyNotSupported}
+	ErrOrderNotFound        = &problem.Problem{Code: problem.CodeOrderNotFound}
+	ErrOrderAlreadyPaid     = &problem.Problem{Code: problem.CodeOrderAlreadyPaid}
+	ErrOrderExpired         = &problem.Problem{Code: problem.CodeOrderExpired}
+	ErrCouponInvalid        = &problem.Problem{Code: problem.CodeCouponInvalid}
+	ErrCouponExpired        = &problem.Problem{Code: problem.CodeCouponExpired}
+	ErrCouponExhausted      = &problem.Problem{Code: problem.CodeCouponExhausted}
+	ErrCouponNotApplicable  = &problem.Problem{Code: problem.CodeCouponNotApplicable}
+	ErrValidationFailed     = &problem.Problem{Code: problem.CodeValidationFailed}
+	ErrRateLimited          = &problem.Problem{Code: problem.CodeRateLimited}
+	ErrUnauthorized         = &problem.Problem{Code: problem.CodeUnauthorized}
+)
+
+// do sends the request and decodes a successful JSON response into v. Error
+// responses are returned as a *problem.Problem.
+func do(req *http.Request, v any) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return problem.FromResponse(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -4,79 +4,141 @@ import (
 	"google.golang.org/genai"
 )
 
-var SystemPrompt = `You are a bot assistant that sells online course about software security. You only use information provided from datastore or tools. You can provide the information that is relevant to the user's question or the summary of the content. If they ask about the content, you can give them more detail about the content. If the user seems interested, you may suggest the user to enroll in the course.`
+var SystemPrompt = `You are a bot assistant that sells online course about software security. You only use information provided from datastore or tools. You can provide the information that is relevant to the user's question or the summary of the content. If they ask about the content, you can give them more detail about the content. If the user seems interested, you may suggest the user to enroll in the course. If a tool answers with an error, do not make up a result: apologise and explain the error message to the user, fix the arguments named in the error, and only call the tool again if the error is retryable. Never call confirm_action unless the user has just agreed to the action.`
 
-var Tools = []*genai.Tool{
-	{
-		FunctionDeclarations: []*genai.FunctionDeclaration{
-			{
-				Name:        "search_course_content",
-				Description: "Explain about software security course materials.",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"query": {
-							Type:        genai.TypeString,
-							Description: "search query to search course content.",
-						},
-					},
-					Required: []string{"query"},
+// Declarations of the functions the course assistant can call. Each is
+// registered together with its handler.
+var (
+	SearchCourseContentDeclaration = &genai.FunctionDeclaration{
+		Name:        "search_course_content",
+		Description: "Explain about software security course materials.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"query": {
+					Type:        genai.TypeString,
+					Description: "search query to search course content.",
 				},
 			},
-			{
-				Name:        "list_courses",
-				Description: "List all available courses sold on the platform.",
+			Required: []string{"query"},
+		},
+	}
+
+	ListCoursesDeclaration = &genai.FunctionDeclaration{
+		Name:        "list_courses",
+		Description: "List all available courses sold on the platform, sorted by name. Optionally filter the courses by a keyword.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"query": {
+					Type:        genai.TypeString,
+					Description: "optional keyword to search in course titles and descriptions, for example security.",
+				},
 			},
-			{
-				Name:        "get_course",
-				Description: "Get course details by course name. course name is the unique identifier of the course. it typically contains the course title with dashes. This function can be used to get course details such as course price, etc.",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"course": {
-							Type:        genai.TypeString,
-							Description: "name of the course. this is the unique identifier of the course. it typically contains the course title with dashes, all in lowercase.",
-						},
-					},
-					Required: []string{"course"},
+		},
+	}
+
+	GetCourseDeclaration = &genai.FunctionDeclaration{
+		Name:        "get_course",
+		Description: "Get course details by course name. course name is the unique identifier of the course. it typically contains the course title with dashes. This function can be used to get course details such as course price, etc.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"course": {
+					Type:        genai.TypeString,
+					Description: "name of the course. this is the unique identifier of the course. it typically contains the course title with dashes, all in lowercase.",
 				},
 			},
-			{
-				Name:        "create_order",
-				Description: "Create order for a course. This function can be used to create an order for a course. When this function returns successfully, it will return payment url to user to make payment.",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"course": {
-							Type:        genai.TypeString,
-							Description: "name of the course. this is the unique identifier of the course. it typically contains the course title with dashes, all in lowercase.",
-						},
-						"user_name": {
-							Type:        genai.TypeString,
-							Description: "name of the user who is purchasing the course .",
-						},
-						"user_email": {
-							Type:        genai.TypeString,
-							Description: "email of the user who is purchasing the course .",
-						},
-					},
-					Required: []string{"course", "user_name", "user_email"},
+			Required: []string{"course"},
+		},
+	}
+
+	CreateOrderDeclaration = &genai.FunctionDeclaration{
+		Name:        "create_order",
+		Description: "Create order for a course. This function can be used to create an order for a course. The order is not created right away: the function returns an action_token, read the course, quantity, coupon and email back to the user and call confirm_action with the token once they agree. When the order is created, it will return payment url to user to make payment. If a coupon was applied, tell the user the original price, the discount and the final price. Always tell the user the subtotal, the tax and the total they will be charged.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"course": {
+					Type:        genai.TypeString,
+					Description: "name of the course. this is the unique identifier of the course. it typically contains the course title with dashes, all in lowercase.",
+				},
+				"quantity": {
+					Type:        genai.TypeInteger,
+					Description: "optional number of seats to buy, for example when the user buys the course for their team. Defaults to 1.",
+				},
+				"user_name": {
+					Type:        genai.TypeString,
+					Description: "name of the user who is purchasing the course .",
+				},
+				"user_email": {
+					Type:        genai.TypeString,
+					Description: "email of the user who is purchasing the course .",
+				},
+				"coupon_code": {
+					Type:        genai.TypeString,
+					Description: "optional promo or coupon code the user mentioned, for example PYCON25. Spell it exactly as the user said it, without spaces.",
+				},
+				"currency": {
+					Type:        genai.TypeString,
+					Description: "optional three letter ISO 4217 code of the currency the user wants to pay in, for example EUR or IDR. Leave empty to use the course currency.",
+				},
+				"country": {
+					Type:        genai.TypeString,
+					Description: "two letter ISO 3166 code of the country the user lives in, for example DE or ID. It is used to compute tax; ask the user if you do not know it.",
 				},
 			},
-			{
-				Name:        "get_order",
-				Description: "Get order by using order number. This function can be used to get order details such as payment status to check whether the order has been paid or not. If user already paid the course, say thanks",
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"order_number": {
-							Type:        genai.TypeString,
-							Description: "order number identifier. this is a unique identifier in uuid format.",
-						},
-					},
-					Required: []string{"order_number"},
+			Required: []string{"course", "user_name", "user_email", "country"},
+		},
+	}
+
+	ListOrdersDeclaration = &genai.FunctionDeclaration{
+		Name:        "list_orders",
+		Description: "List orders made by a user, oldest first. This function can be used to answer what the user has bought or ordered before. Use the status filter with value paid to only list purchased courses.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"user_email": {
+					Type:        genai.TypeString,
+					Description: "email of the user whose orders are listed.",
+				},
+				"status": {
+					Type:        genai.TypeString,
+					Description: "optional order status filter. one of pending, paid, cancelled, expired or refunded.",
+					Enum:        []string{"pending", "paid", "cancelled", "expired", "refunded"},
+				},
+			},
+			Required: []string{"user_email"},
+		},
+	}
+
+	ListMyEnrollmentsDeclaration = &genai.FunctionDeclaration{
+		Name:        "list_my_enrollments",
+		Description: "List the courses the user is enrolled in, i.e. has paid for and can access. Use this to answer which courses the user has access to. Refunded courses are not listed.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"user_email": {
+					Type:        genai.TypeString,
+					Description: "email of the user whose enrollments are listed.",
+				},
+			},
+			Required: []string{"user_email"},
+		},
+	}
+
+	GetOrderDeclaration = &genai.FunctionDeclaration{
+		Name:        "get_order",
+		Description: "Get order by using order number. This function can be used to get order details such as payment status to check whether the order has been paid or not. Status is one of pending, paid, cancelled, expired or refunded. If user already paid the course, say thanks",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"order_number": {
+					Type:        genai.TypeString,
+					Description: "order number identifier. this is a unique identifier in uuid format.",
 				},
 			},
+			Required: []string{"order_number"},
 		},
-	},
-}
+	}
+)
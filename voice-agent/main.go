@@ -6,6 +6,8 @@ import (
 	"os/signal"
 	"syscall"
 
+	"voice-agent/courses"
+
 	gogenai "github.com/google/generative-ai-go/genai"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/option"
@@ -31,6 +33,12 @@ func main() {
 		cancel()
 	}()
 
+	coursesConfig := courses.ConfigFromEnv()
+	if coursesConfig.APIKey == "" {
+		log.Warn().Msg("COURSES_API_KEY is not set, course API calls will be rejected")
+	}
+	courses.Configure(coursesConfig)
+
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		Project:  project,
 		Location: region,
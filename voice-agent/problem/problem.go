@@ -0,0 +1,138 @@
+// Package problem implements the RFC 7807 problem details format that the
+// course API and the voice agent use for error responses.
+package problem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const ContentType = "application/problem+json"
+
+// Code identifies the kind of an error for programs, independent of the
+// HTTP status and the human readable detail. The values match the codes
+// returned by the course API.
+type Code string
+
+const (
+	CodeInvalidRequest     Code = "invalid_request"
+	CodeInvalidParameter   Code = "invalid_parameter"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInsufficientScope  Code = "insufficient_scope"
+	CodeNotFound           Code = "not_found"
+	CodeRateLimited        Code = "rate_limited"
+	CodeInternal           Code = "internal_error"
+	CodePaymentProvider    Code = "payment_provider_error"
+	CodeIdempotencyReused  Code = "idempotency_key_reused"
+	CodeIdempotencyPending Code = "idempotency_key_in_progress"
+
+	CodeCourseNotFound       Code = "course_not_found"
+	CodeCourseArchived       Code = "course_archived"
+	CodeCurrencyNotSupported Code = "currency_not_supported"
+	CodeOrderNotFound        Code = "order_not_found"
+	CodeOrderAlreadyPaid     Code = "order_already_paid"
+	CodeOrderNotPaid         Code = "order_not_paid"
+	CodeOrderCancelled       Code = "order_cancelled"
+	CodeOrderExpired         Code = "order_expired"
+	CodeOrderRefunded        Code = "order_refunded"
+	CodeCartNotFound         Code = "cart_not_found"
+	CodeCartCheckedOut       Code = "cart_checked_out"
+	CodeCouponInvalid        Code = "coupon_invalid"
+	CodeCouponExpired        Code = "coupon_expired"
+	CodeCouponExhausted      Code = "coupon_exhausted"
+	CodeCouponNotApplicable  Code = "coupon_not_applicable"
+)
+
+// Problem is a problem details body. It implements error, and errors.Is
+// matches two problems with the same Code.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   Code         `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why one field of a request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New returns a problem with the given status, code and detail.
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	msg := string(p.Code)
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	for _, fe := range p.Errors {
+		if fe.Message != p.Detail {
+			msg += "; " + fe.Field + ": " + fe.Message
+		}
+	}
+	return msg
+}
+
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Code == p.Code
+}
+
+// Write sends the problem as the response.
+func Write(w http.ResponseWriter, p *Problem) {
+	b, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+// FromResponse reads the error response into a *Problem. Bodies that are
+// not problem details still give a Problem with a code derived from the
+// status.
+func FromResponse(resp *http.Response) *Problem {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var p Problem
+	if err := json.Unmarshal(body, &p); err != nil || p.Code == "" {
+		detail := strings.TrimSpace(string(body))
+		if detail == "" {
+			detail = fmt.Sprintf("request failed with status %d", resp.StatusCode)
+		}
+		return New(resp.StatusCode, statusCode(resp.StatusCode), detail)
+	}
+	if p.Status == 0 {
+		p.Status = resp.StatusCode
+	}
+	return &p
+}
+
+func statusCode(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeInsufficientScope
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	return CodeInternal
+}
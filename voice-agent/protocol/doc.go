@@ -0,0 +1,51 @@
+// Package protocol defines the messages the browser and the voice agent
+// exchange over the voice session websocket, and their translation to and
+// from the Live API messages of the genai package.
+//
+// # Versioning
+//
+// Clients ask for a version of the protocol with the websocket subprotocol
+// header, e.g. Sec-WebSocket-Protocol: voice-agent.v1. Connections that do
+// not ask for a version the agent speaks are refused with a 400 before the
+// upgrade. A version only changes when a message is changed or removed in
+// an incompatible way; new message types and fields may be added to a
+// version, and clients should ignore the ones they do not know.
+//
+// # Messages
+//
+// Every message is a JSON text frame with a "type" and one field, named
+// after the type, that holds its payload.
+//
+// The client sends:
+//
+//	{"type": "audio", "audio": {"data": "<base64 PCM>", "mimeType": "audio/pcm"}}
+//	    A chunk of microphone audio. The model decides itself when the
+//	    user has finished speaking.
+//	{"type": "text", "text": "What does the course cost?"}
+//	    A typed message from the user. It completes the user's turn.
+//	{"type": "control", "control": {"event": "approve_action", "actionToken": "..."}}
+//	{"type": "control", "control": {"event": "decline_action", "actionToken": "..."}}
+//	    The user approved or declined an action that waits for
+//	    confirmation, see the tool message below.
+//
+// The agent sends:
+//
+//	{"type": "session", "session": {"id": "...", "version": 1, "tools": ["get_course"]}}
+//	    First message of every connection.
+//	{"type": "audio", "audio": {"data": "<base64 PCM>", "mimeType": "audio/pcm;rate=24000"}}
+//	    A chunk of the model's spoken answer.
+//	{"type": "transcript", "transcript": {"role": "model", "text": "..."}}
+//	    Text of the model's answer. Chunks of a turn are to be joined.
+//	{"type": "turn", "turn": {"event": "complete"}}
+//	    The model finished its turn, or with "interrupted" stopped
+//	    because the user spoke; audio that was not played yet should
+//	    be dropped then.
+//	{"type": "tool", "tool": {"id": "...", "name": "create_order", "status": "running"}}
+//	    Progress of a function call the model made. status is running,
+//	    succeeded, failed (with an "error"), cancelled or
+//	    confirmation_required. Calls that need confirmation carry an
+//	    "action" with the token, the arguments and when it expires.
+//	{"type": "error", "error": {"code": "invalid_message", "message": "..."}}
+//	    Something went wrong. Errors with fatal set are followed by
+//	    the agent closing the connection.
+package protocol
@@ -0,0 +1,251 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// Version is the protocol version the agent speaks.
+	Version = 1
+	// Subprotocol is the websocket subprotocol clients ask for to speak
+	// Version.
+	Subprotocol = "voice-agent.v1"
+)
+
+// ErrInvalidMessage is returned for client messages that do not follow
+// the protocol.
+var ErrInvalidMessage = errors.New("invalid message")
+
+type ClientMessageType string
+
+const (
+	ClientAudio   ClientMessageType = "audio"
+	ClientText    ClientMessageType = "text"
+	ClientControl ClientMessageType = "control"
+)
+
+// ClientMessage is a message from the browser.
+type ClientMessage struct {
+	Type    ClientMessageType `json:"type"`
+	Audio   *Audio            `json:"audio,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	Control *Control          `json:"control,omitempty"`
+}
+
+// Audio is a chunk of PCM audio, base64 encoded in JSON.
+type Audio struct {
+	Data     []byte `json:"data"`
+	MimeType string `json:"mimeType"`
+}
+
+type ControlEvent string
+
+const (
+	ControlApproveAction ControlEvent = "approve_action"
+	ControlDeclineAction ControlEvent = "decline_action"
+)
+
+// Control is an event of the client UI rather than user input for the
+// model.
+type Control struct {
+	Event       ControlEvent `json:"event"`
+	ActionToken string       `json:"actionToken,omitempty"`
+}
+
+// Validate reports messages whose type is unknown or whose payload is
+// missing.
+func (m *ClientMessage) Validate() error {
+	switch m.Type {
+	case ClientAudio:
+		if m.Audio == nil || len(m.Audio.Data) == 0 {
+			return fmt.Errorf("%w: audio message without data", ErrInvalidMessage)
+		}
+	case ClientText:
+		if m.Text == "" {
+			return fmt.Errorf("%w: text message without text", ErrInvalidMessage)
+		}
+	case ClientControl:
+		if m.Control == nil {
+			return fmt.Errorf("%w: control message without control", ErrInvalidMessage)
+		}
+		switch m.Control.Event {
+		case ControlApproveAction, ControlDeclineAction:
+			if m.Control.ActionToken == "" {
+				return fmt.Errorf("%w: control event needs an action token", ErrInvalidMessage)
+			}
+		default:
+			return fmt.Errorf("%w: unknown control event %s", ErrInvalidMessage, m.Control.Event)
+		}
+	default:
+		return fmt.Errorf("%w: unknown message type %s", ErrInvalidMessage, m.Type)
+	}
+	return nil
+}
+
+// LiveClientMessage translates user input to the message for the live
+// session. Control messages are handled by the agent and give nil.
+func (m *ClientMessage) LiveClientMessage() *genai.LiveClientMessage {
+	switch m.Type {
+	case ClientAudio:
+		return &genai.LiveClientMessage{
+			RealtimeInput: &genai.LiveClientRealtimeInput{
+				MediaChunks: []*genai.Blob{
+					{Data: m.Audio.Data, MIMEType: m.Audio.MimeType},
+				},
+			},
+		}
+	case ClientText:
+		return &genai.LiveClientMessage{
+			ClientContent: &genai.LiveClientContent{
+				Turns: []*genai.Content{
+					{
+						Role:  "user",
+						Parts: []*genai.Part{{Text: m.Text}},
+					},
+				},
+				TurnComplete: true,
+			},
+		}
+	}
+	return nil
+}
+
+type ServerMessageType string
+
+const (
+	ServerSession    ServerMessageType = "session"
+	ServerAudio      ServerMessageType = "audio"
+	ServerTranscript ServerMessageType = "transcript"
+	ServerTurn       ServerMessageType = "turn"
+	ServerTool       ServerMessageType = "tool"
+	ServerError      ServerMessageType = "error"
+)
+
+// ServerMessage is a message to the browser. Exactly one payload is set,
+// the one named by Type.
+type ServerMessage struct {
+	Type       ServerMessageType `json:"type"`
+	Session    *Session          `json:"session,omitempty"`
+	Audio      *Audio            `json:"audio,omitempty"`
+	Transcript *Transcript       `json:"transcript,omitempty"`
+	Turn       *Turn             `json:"turn,omitempty"`
+	Tool       *ToolActivity     `json:"tool,omitempty"`
+	Error      *Error            `json:"error,omitempty"`
+}
+
+// Session describes the connection once the live session is set up.
+type Session struct {
+	ID      string   `json:"id"`
+	Version int      `json:"version"`
+	Tools   []string `json:"tools"`
+}
+
+// Transcript is text of a turn. Role is model for the model's answers.
+type Transcript struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+type TurnEvent string
+
+const (
+	TurnComplete    TurnEvent = "complete"
+	TurnInterrupted TurnEvent = "interrupted"
+)
+
+type Turn struct {
+	Event TurnEvent `json:"event"`
+}
+
+type ToolStatus string
+
+const (
+	ToolRunning              ToolStatus = "running"
+	ToolSucceeded            ToolStatus = "succeeded"
+	ToolFailed               ToolStatus = "failed"
+	ToolCancelled            ToolStatus = "cancelled"
+	ToolConfirmationRequired ToolStatus = "confirmation_required"
+)
+
+// ToolActivity reports the progress of a function call.
+type ToolActivity struct {
+	ID     string     `json:"id,omitempty"`
+	Name   string     `json:"name,omitempty"`
+	Status ToolStatus `json:"status"`
+	Error  *Error     `json:"error,omitempty"`
+	Action *Action    `json:"action,omitempty"`
+}
+
+// Action is a function call waiting for the user's confirmation.
+type Action struct {
+	Token     string         `json:"token"`
+	Args      map[string]any `json:"args"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+}
+
+// Error codes of the error message.
+const (
+	CodeInvalidMessage    = "invalid_message"
+	CodeSessionFailed     = "session_failed"
+	CodeToolFailureBudget = "tool_failure_budget"
+)
+
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fatal reports that the agent closes the connection after the error.
+	Fatal bool `json:"fatal,omitempty"`
+}
+
+// FromLiveServerMessage translates a message of the live session to the
+// messages for the browser. Tool calls are reported as running; their
+// outcome is reported by the agent once they are done.
+func FromLiveServerMessage(msg *genai.LiveServerMessage) []ServerMessage {
+	var out []ServerMessage
+	if sc := msg.ServerContent; sc != nil {
+		if sc.ModelTurn != nil {
+			for _, part := range sc.ModelTurn.Parts {
+				switch {
+				case part.InlineData != nil:
+					out = append(out, ServerMessage{Type: ServerAudio, Audio: &Audio{
+						Data:     part.InlineData.Data,
+						MimeType: part.InlineData.MIMEType,
+					}})
+				case part.Text != "":
+					out = append(out, ServerMessage{Type: ServerTranscript, Transcript: &Transcript{
+						Role: "model",
+						Text: part.Text,
+					}})
+				}
+			}
+		}
+		if sc.Interrupted {
+			out = append(out, ServerMessage{Type: ServerTurn, Turn: &Turn{Event: TurnInterrupted}})
+		}
+		if sc.TurnComplete {
+			out = append(out, ServerMessage{Type: ServerTurn, Turn: &Turn{Event: TurnComplete}})
+		}
+	}
+	if msg.ToolCall != nil {
+		for _, fc := range msg.ToolCall.FunctionCalls {
+			out = append(out, ServerMessage{Type: ServerTool, Tool: &ToolActivity{
+				ID:     fc.ID,
+				Name:   fc.Name,
+				Status: ToolRunning,
+			}})
+		}
+	}
+	if msg.ToolCallCancellation != nil {
+		for _, id := range msg.ToolCallCancellation.IDs {
+			out = append(out, ServerMessage{Type: ServerTool, Tool: &ToolActivity{
+				ID:     id,
+				Status: ToolCancelled,
+			}})
+		}
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestClientMessageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     ClientMessage
+		wantErr bool
+	}{
+		{name: "audio", msg: ClientMessage{Type: ClientAudio, Audio: &Audio{Data: []byte{1, 2}, MimeType: "audio/pcm"}}},
+		{name: "audio without payload", msg: ClientMessage{Type: ClientAudio}, wantErr: true},
+		{name: "audio without data", msg: ClientMessage{Type: ClientAudio, Audio: &Audio{MimeType: "audio/pcm"}}, wantErr: true},
+		{name: "text", msg: ClientMessage{Type: ClientText, Text: "hello"}},
+		{name: "empty text", msg: ClientMessage{Type: ClientText}, wantErr: true},
+		{name: "approve", msg: ClientMessage{Type: ClientControl, Control: &Control{Event: ControlApproveAction, ActionToken: "tok"}}},
+		{name: "decline", msg: ClientMessage{Type: ClientControl, Control: &Control{Event: ControlDeclineAction, ActionToken: "tok"}}},
+		{name: "control without payload", msg: ClientMessage{Type: ClientControl}, wantErr: true},
+		{name: "control without token", msg: ClientMessage{Type: ClientControl, Control: &Control{Event: ControlApproveAction}}, wantErr: true},
+		{name: "unknown control", msg: ClientMessage{Type: ClientControl, Control: &Control{Event: "mute", ActionToken: "tok"}}, wantErr: true},
+		{name: "unknown type", msg: ClientMessage{Type: "video", Text: "hello"}, wantErr: true},
+		{name: "no type", msg: ClientMessage{Text: "hello"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidMessage) {
+				t.Fatalf("Validate() = %v, want ErrInvalidMessage", err)
+			}
+		})
+	}
+}
+
+func TestClientMessageJSON(t *testing.T) {
+	var msg ClientMessage
+	if err := json.Unmarshal([]byte(`{"type":"audio","audio":{"data":"AQI=","mimeType":"audio/pcm;rate=16000"}}`), &msg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := ClientMessage{Type: ClientAudio, Audio: &Audio{Data: []byte{1, 2}, MimeType: "audio/pcm;rate=16000"}}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("decoded %+v, want %+v", msg, want)
+	}
+}
+
+func TestLiveClientMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  ClientMessage
+		want *genai.LiveClientMessage
+	}{
+		{
+			name: "audio",
+			msg:  ClientMessage{Type: ClientAudio, Audio: &Audio{Data: []byte{1, 2}, MimeType: "audio/pcm"}},
+			want: &genai.LiveClientMessage{
+				RealtimeInput: &genai.LiveClientRealtimeInput{
+					MediaChunks: []*genai.Blob{{Data: []byte{1, 2}, MIMEType: "audio/pcm"}},
+				},
+			},
+		},
+		{
+			name: "text",
+			msg:  ClientMessage{Type: ClientText, Text: "hello"},
+			want: &genai.LiveClientMessage{
+				ClientContent: &genai.LiveClientContent{
+					Turns:        []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hello"}}}},
+					TurnComplete: true,
+				},
+			},
+		},
+		{
+			name: "control",
+			msg:  ClientMessage{Type: ClientControl, Control: &Control{Event: ControlApproveAction, ActionToken: "tok"}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.LiveClientMessage(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LiveClientMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromLiveServerMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *genai.LiveServerMessage
+		want []ServerMessage
+	}{
+		{
+			name: "audio and transcript",
+			msg: &genai.LiveServerMessage{ServerContent: &genai.LiveServerContent{
+				ModelTurn: &genai.Content{Parts: []*genai.Part{
+					{InlineData: &genai.Blob{Data: []byte{1, 2}, MIMEType: "audio/pcm;rate=24000"}},
+					{Text: "Hello"},
+					{},
+				}},
+			}},
+			want: []ServerMessage{
+				{Type: ServerAudio, Audio: &Audio{Data: []byte{1, 2}, MimeType: "audio/pcm;rate=24000"}},
+				{Type: ServerTranscript, Transcript: &Transcript{Role: "model", Text: "Hello"}},
+			},
+		},
+		{
+			name: "turn complete",
+			msg:  &genai.LiveServerMessage{ServerContent: &genai.LiveServerContent{TurnComplete: true}},
+			want: []ServerMessage{{Type: ServerTurn, Turn: &Turn{Event: TurnComplete}}},
+		},
+		{
+			name: "interrupted",
+			msg:  &genai.LiveServerMessage{ServerContent: &genai.LiveServerContent{Interrupted: true, TurnComplete: true}},
+			want: []ServerMessage{
+				{Type: ServerTurn, Turn: &Turn{Event: TurnInterrupted}},
+				{Type: ServerTurn, Turn: &Turn{Event: TurnComplete}},
+			},
+		},
+		{
+			name: "tool call",
+			msg: &genai.LiveServerMessage{ToolCall: &genai.LiveServerToolCall{FunctionCalls: []*genai.FunctionCall{
+				{ID: "1", Name: "list_courses"},
+				{ID: "2", Name: "get_course", Args: map[string]any{"id": "go"}},
+			}}},
+			want: []ServerMessage{
+				{Type: ServerTool, Tool: &ToolActivity{ID: "1", Name: "list_courses", Status: ToolRunning}},
+				{Type: ServerTool, Tool: &ToolActivity{ID: "2", Name: "get_course", Status: ToolRunning}},
+			},
+		},
+		{
+			name: "tool call cancellation",
+			msg:  &genai.LiveServerMessage{ToolCallCancellation: &genai.LiveServerToolCallCancellation{IDs: []string{"1", "2"}}},
+			want: []ServerMessage{
+				{Type: ServerTool, Tool: &ToolActivity{ID: "1", Status: ToolCancelled}},
+				{Type: ServerTool, Tool: &ToolActivity{ID: "2", Status: ToolCancelled}},
+			},
+		},
+		{
+			name: "nothing for the browser",
+			msg:  &genai.LiveServerMessage{SetupComplete: &genai.LiveServerSetupComplete{}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromLiveServerMessage(tt.msg)
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("FromLiveServerMessage() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestServerMessageJSON(t *testing.T) {
+	// Only the payload named by the type is sent.
+	b, err := json.Marshal(ServerMessage{Type: ServerTurn, Turn: &Turn{Event: TurnComplete}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if want := `{"type":"turn","turn":{"event":"complete"}}`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+}
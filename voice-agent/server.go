@@ -2,13 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"slices"
+	"sync"
 	"time"
 
 	"net/http"
 	"voice-agent/courses"
 	"voice-agent/interviews"
+	"voice-agent/problem"
+	"voice-agent/protocol"
+	"voice-agent/tools"
 
 	_ "embed"
 
@@ -20,30 +29,77 @@ import (
 	"google.golang.org/genai"
 )
 
-var upgrader = websocket.Upgrader{}
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{protocol.Subprotocol},
+}
 
 const (
 	modelName          = "gemini-2.0-flash-exp"
 	embeddingModelName = "text-embedding-004"
+
+	// toolFailureBudget is how many tool calls may fail in a session
+	// before it is ended, so a model retrying broken calls forever does
+	// not keep the session open.
+	toolFailureBudget = 10
+	// maxConcurrentTools is how many function calls of a session may run
+	// at once.
+	maxConcurrentTools = 4
+	// toolTimeout limits function calls of tools registered without a
+	// timeout of their own.
+	toolTimeout = 15 * time.Second
 )
 
+var errToolFailureBudget = errors.New("too many failed tool calls")
+
 //go:embed index.html
 var homeTemplate string
 
-func (s Server) voiceChaHandler(model string, cfg *genai.LiveConnectConfig) http.HandlerFunc {
+// voiceChaHandler bridges a browser websocket speaking the protocol package
+// and a live session. Function calls of the model are run with the tools
+// of registry, which should be the registry cfg.Tools was generated from.
+func (s Server) voiceChaHandler(model string, cfg *genai.LiveConnectConfig, registry *tools.Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(websocket.Subprotocols(r), protocol.Subprotocol) {
+			problem.Write(w, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest,
+				"websocket subprotocol "+protocol.Subprotocol+" is required"))
+			return
+		}
 		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
+			// Upgrade has already answered the request.
 			log.Error().Err(err).Msg("upgrade websocket error")
-			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 		defer c.Close()
 
+		// The model's messages, the tool activity and errors are written
+		// to the browser from different goroutines.
+		var writeMu sync.Mutex
+		write := func(msg protocol.ServerMessage) error {
+			b, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return c.WriteMessage(websocket.TextMessage, b)
+		}
+		// closeWithError tells the browser why the session ends.
+		closeWithError := func(code string, err error) {
+			write(protocol.ServerMessage{Type: protocol.ServerError, Error: &protocol.Error{
+				Code:    code,
+				Message: err.Error(),
+				Fatal:   true,
+			}})
+			c.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInternalServerErr, code),
+				time.Now().Add(time.Second))
+		}
+
 		session, err := s.GenAIClient.Live.Connect(model, cfg)
 		if err != nil {
 			log.Error().Err(err).Msg("unable to start live session")
-			writeError(w, http.StatusInternalServerError, err)
+			closeWithError(protocol.CodeSessionFailed, err)
 			return
 		}
 		defer session.Close()
@@ -51,62 +107,199 @@ func (s Server) voiceChaHandler(model string, cfg *genai.LiveConnectConfig) http
 		errChan := make(chan error)
 		doneChan := make(chan struct{})
 
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		// fail reports err and done the end of the session, unless the
+		// handler already returned.
+		fail := func(err error) {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+			}
+		}
+		done := func() {
+			select {
+			case doneChan <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+
+		// The browser audio and the tool responses are sent from
+		// different goroutines, but a session allows one writer only.
+		var sendMu sync.Mutex
+		send := func(msg *genai.LiveClientMessage) error {
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			return session.Send(msg)
+		}
+
+		runner := tools.NewRunner(registry, maxConcurrentTools, toolTimeout, toolFailure)
+		budget := &tools.FailureBudget{Max: toolFailureBudget}
+		// writeAction tells the browser about a pending action, so it can
+		// offer to approve it or withdraw that offer.
+		writeAction := func(action tools.PendingAction, status protocol.ToolStatus) {
+			err := write(protocol.ServerMessage{Type: protocol.ServerTool, Tool: &protocol.ToolActivity{
+				ID:     action.ID,
+				Name:   action.Name,
+				Status: status,
+				Action: &protocol.Action{
+					Token:     action.Token,
+					Args:      action.Args,
+					ExpiresAt: action.ExpiresAt,
+				},
+			}})
+			if err != nil {
+				log.Warn().Err(err).Str("name", action.Name).Msg("write pending action error")
+			}
+		}
+		// Let the browser offer a button to approve actions that wait for
+		// the user's confirmation.
+		runner.OnHold = func(action tools.PendingAction) {
+			writeAction(action, protocol.ToolConfirmationRequired)
+		}
+		// reportTool tells the browser how a function call ended. Held
+		// calls were reported by OnHold already.
+		reportTool := func(id, name string, res tools.Result) {
+			activity := &protocol.ToolActivity{ID: id, Name: name, Status: protocol.ToolSucceeded}
+			switch {
+			case res.Held:
+				return
+			case res.Response == nil:
+				activity.Status = protocol.ToolCancelled
+			case res.Failure != nil:
+				activity.Status = protocol.ToolFailed
+				activity.Error = &protocol.Error{Code: res.Failure.Code, Message: res.Failure.Message}
+			}
+			if err := write(protocol.ServerMessage{Type: protocol.ServerTool, Tool: activity}); err != nil {
+				log.Warn().Err(err).Str("name", name).Msg("write tool activity error")
+			}
+		}
+
+		// runTools answers a tool call once all of its function calls are
+		// done. It runs on its own goroutine so the model's audio keeps
+		// flowing to the browser meanwhile.
+		runTools := func(calls []*genai.FunctionCall) {
+			for _, fc := range calls {
+				log.Debug().Str("name", fc.Name).
+					Str("id", fc.ID).
+					Any("params", fc.Args).
+					Msg("checking function call")
+			}
+			results := runner.Run(ctx, calls)
+			for i, res := range results {
+				reportTool(calls[i].ID, calls[i].Name, res)
+			}
+			if budget.Record(results) {
+				log.Error().Msg("tool failure budget exhausted")
+				fail(errToolFailureBudget)
+				return
+			}
+
+			var functionResponses []*genai.FunctionResponse
+			for _, res := range results {
+				if res.Response != nil {
+					functionResponses = append(functionResponses, res.Response)
+				}
+			}
+			if len(functionResponses) == 0 || ctx.Err() != nil {
+				return
+			}
+			log.Debug().Msg("sending tool response")
+			err := send(&genai.LiveClientMessage{
+				ToolResponse: &genai.LiveClientToolResponse{
+					FunctionResponses: functionResponses,
+				},
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("send tool response error")
+				fail(err)
+				return
+			}
+			log.Debug().Msg("tool response sent")
+		}
+
+		// decideAction runs or drops a pending action the user approved or
+		// declined in the browser, and tells the model about it, since the
+		// model only knows the action is waiting.
+		decideAction := func(control *protocol.Control) {
+			var text string
+			if control.Event == protocol.ControlApproveAction {
+				res := runner.Approve(ctx, control.ActionToken)
+				reportTool("", tools.ConfirmActionDeclaration.Name, res)
+				if budget.Record([]tools.Result{res}) {
+					fail(errToolFailureBudget)
+					return
+				}
+				b, _ := json.Marshal(res.Response.Response)
+				text = fmt.Sprintf("I approved the pending action %s in the app. This is the result of confirm_action: %s", control.ActionToken, b)
+			} else {
+				action := runner.Decline(control.ActionToken)
+				if action == nil {
+					return
+				}
+				text = fmt.Sprintf("I declined the pending %s action %s in the app. Do not run it.", action.Name, control.ActionToken)
+			}
+			err := send(&genai.LiveClientMessage{
+				ClientContent: &genai.LiveClientContent{
+					Turns: []*genai.Content{
+						{
+							Role:  "user",
+							Parts: []*genai.Part{{Text: text}},
+						},
+					},
+					TurnComplete: true,
+				},
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("send action decision error")
+				fail(err)
+			}
+		}
+
+		err = write(protocol.ServerMessage{Type: protocol.ServerSession, Session: &protocol.Session{
+			ID:      newSessionID(),
+			Version: protocol.Version,
+			Tools:   registry.Names(),
+		}})
+		if err != nil {
+			log.Error().Err(err).Msg("write session error")
+			return
+		}
+
 		// Get model's response
 		go func() {
 			for {
 				message, err := session.Receive()
 				if err != nil {
 					log.Error().Err(err).Msg("receive error on live session response")
-					errChan <- err
+					fail(err)
 					return
 				}
 
-				var functionResponses []*genai.FunctionResponse
 				if message.ToolCall != nil {
-					functionCalls := message.ToolCall.FunctionCalls
-					for _, fc := range functionCalls {
-						log.Debug().Str("name", fc.Name).
-							Str("id", fc.ID).
-							Any("params", fc.Args).
-							Msg("checking function call")
-						fr, err := s.Dispatch(r.Context(), fc)
-						if err != nil {
-							log.Error().Err(err).Msg("dispatch error")
-							errChan <- err
-							return
-						}
-						functionResponses = append(functionResponses, fr)
-					}
-					log.Debug().Msg("sending tool response")
-					err := session.Send(&genai.LiveClientMessage{
-						ToolResponse: &genai.LiveClientToolResponse{
-							FunctionResponses: functionResponses,
-						},
-					})
-					if err != nil {
-						log.Error().Err(err).Msg("send tool response error")
-						errChan <- err
-						return
+					go runTools(message.ToolCall.FunctionCalls)
+				}
+				if message.ToolCallCancellation != nil {
+					log.Debug().Strs("ids", message.ToolCallCancellation.IDs).Msg("cancelling function calls")
+					// Held actions of cancelled calls can no longer be
+					// approved, so take their buttons away.
+					for _, action := range runner.Cancel(message.ToolCallCancellation.IDs) {
+						writeAction(action, protocol.ToolCancelled)
 					}
-					log.Debug().Msg("tool response sent")
 				}
 
-				messageBytes, err := json.Marshal(message)
-				if err != nil {
-					log.Error().Err(err).Msg("marshal model response error")
-					errChan <- err
-					return
-				}
-				err = c.WriteMessage(websocket.TextMessage, messageBytes)
-				if err != nil {
-					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-						log.Error().Err(err).Msg("got unexpected websocket close error in write")
-						errChan <- err
-					} else {
-						log.Debug().Err(err).Msg("websocket closed in write")
-						doneChan <- struct{}{}
+				for _, msg := range protocol.FromLiveServerMessage(message) {
+					err = write(msg)
+					if err != nil {
+						if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+							log.Error().Err(err).Msg("got unexpected websocket close error in write")
+							fail(err)
+						} else {
+							log.Debug().Err(err).Msg("websocket closed in write")
+							done()
+						}
+						return
 					}
-					return
 				}
 			}
 		}()
@@ -117,27 +310,37 @@ func (s Server) voiceChaHandler(model string, cfg *genai.LiveConnectConfig) http
 				if err != nil {
 					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 						log.Error().Err(err).Msg("got unexpected websocket close error in read")
-						errChan <- err
+						fail(err)
 					} else {
 						log.Debug().Err(err).Msg("websocket closed in read")
-						doneChan <- struct{}{}
+						done()
 					}
 					return
 				}
 
-				// TODO currently the input is genai.LiveClientMessage,
-				// we can create different contract with our client
-				// and convert it to genai.LiveClientMessage later
-				var sendMessage genai.LiveClientMessage
-				if err := json.Unmarshal(message, &sendMessage); err != nil {
-					log.Error().Err(err).Msg("unmarshal message error")
-					errChan <- err
-					return
+				// A bad message is the client's mistake; tell it and keep
+				// the session going.
+				var clientMessage protocol.ClientMessage
+				err = json.Unmarshal(message, &clientMessage)
+				if err == nil {
+					err = clientMessage.Validate()
+				}
+				if err != nil {
+					log.Warn().Err(err).Msg("invalid client message")
+					write(protocol.ServerMessage{Type: protocol.ServerError, Error: &protocol.Error{
+						Code:    protocol.CodeInvalidMessage,
+						Message: err.Error(),
+					}})
+					continue
 				}
 
-				if err := session.Send(&sendMessage); err != nil {
+				if clientMessage.Type == protocol.ClientControl {
+					go decideAction(clientMessage.Control)
+					continue
+				}
+				if err := send(clientMessage.LiveClientMessage()); err != nil {
 					log.Error().Err(err).Msg("send message to session error")
-					errChan <- err
+					fail(err)
 					return
 				}
 			}
@@ -152,16 +355,28 @@ func (s Server) voiceChaHandler(model string, cfg *genai.LiveConnectConfig) http
 				if !ok {
 					log.Warn().Msg("error channel closed")
 					return
-				} else {
-					writeError(w, http.StatusInternalServerError, err)
-					return
 				}
+				code := protocol.CodeSessionFailed
+				if errors.Is(err, errToolFailureBudget) {
+					code = protocol.CodeToolFailureBudget
+				}
+				closeWithError(code, err)
+				return
 			}
 		}
 	}
 }
 
+// newSessionID returns a random ID for a voice session, to match the
+// browser's reports with the agent's logs.
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (s Server) CourseVoiceChaHandler() http.HandlerFunc {
+	registry := s.CourseTools()
 	config := &genai.LiveConnectConfig{
 		GenerationConfig: &genai.GenerationConfig{
 			AudioTimestamp: true,
@@ -184,9 +399,9 @@ func (s Server) CourseVoiceChaHandler() http.HandlerFunc {
 				},
 			},
 		},
-		Tools: courses.Tools,
+		Tools: registry.Tools(),
 	}
-	return s.voiceChaHandler(modelName, config)
+	return s.voiceChaHandler(modelName, config, registry)
 }
 
 func (s Server) InterviewerVoiceChaHandler() http.HandlerFunc {
@@ -213,7 +428,7 @@ func (s Server) InterviewerVoiceChaHandler() http.HandlerFunc {
 			},
 		},
 	}
-	return s.voiceChaHandler(modelName, config)
+	return s.voiceChaHandler(modelName, config, tools.NewRegistry())
 }
 
 func (s Server) CourseAgent() http.HandlerFunc {
@@ -285,14 +500,3 @@ func (s *Server) Start(ctx context.Context) {
 		log.Error().Err(err).Msg("failed to shutdown http server gracefully")
 	}
 }
-
-type cError struct {
-	Message string `json:"message"`
-}
-
-func writeError(w http.ResponseWriter, code int, err error) {
-	w.WriteHeader(code)
-	b, _ := json.Marshal(cError{Message: err.Error()})
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(b)
-}
@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"net/http"
+	"time"
 
 	"voice-agent/courses"
+	"voice-agent/problem"
+	"voice-agent/tools"
 
 	"github.com/rs/zerolog/log"
 
@@ -13,29 +17,73 @@ import (
 	"google.golang.org/genai"
 )
 
-func (s Server) Dispatch(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
-	switch fc.Name {
-	case "list_courses":
-		return s.ListCourses(ctx)
-	case "get_course":
-		return s.GetCourse(ctx, fc)
-	case "create_order":
-		return s.CreateOrder(ctx, fc)
-	case "get_order":
-		return s.GetOrder(ctx, fc)
-	case "search_course_content":
-		return s.SearchCourseContent(ctx, fc.Args["query"].(string))
-	default:
-		return nil, fmt.Errorf("unknown function %s", fc.Name)
-	}
-}
-
-func (s Server) GetOrder(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
-	orderNumber, ok := fc.Args["order_number"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing order number")
-	}
-	o, err := courses.GetOrder(ctx, orderNumber)
+// CourseTools registers the functions the course assistant can call.
+func (s Server) CourseTools() *tools.Registry {
+	r := tools.NewRegistry()
+	tools.Register(r, courses.SearchCourseContentDeclaration, s.SearchCourseContent, tools.WithTimeout(10*time.Second))
+	tools.Register(r, courses.ListCoursesDeclaration, s.ListCourses)
+	tools.Register(r, courses.GetCourseDeclaration, s.GetCourse)
+	// Creating an order opens a checkout session with the payment
+	// provider, which may take a while, and reserves coupons, so the user
+	// has to confirm it first.
+	tools.Register(r, courses.CreateOrderDeclaration, s.CreateOrder,
+		tools.WithTimeout(30*time.Second), tools.RequiresConfirmation())
+	tools.Register(r, courses.ListOrdersDeclaration, s.ListOrders)
+	tools.Register(r, courses.ListMyEnrollmentsDeclaration, s.ListMyEnrollments)
+	tools.Register(r, courses.GetOrderDeclaration, s.GetOrder)
+	return r
+}
+
+// toolFailure describes err for the model. Problems reported by the course
+// API keep their code, detail and field errors.
+func toolFailure(err error) *tools.Failure {
+	var p *problem.Problem
+	if !errors.As(err, &p) {
+		return tools.AsFailure(err)
+	}
+	f := &tools.Failure{
+		Code:    string(p.Code),
+		Message: p.Detail,
+		Retryable: p.Code == problem.CodeRateLimited ||
+			p.Code == problem.CodeIdempotencyPending ||
+			p.Status >= http.StatusInternalServerError,
+	}
+	if f.Message == "" {
+		f.Message = p.Title
+	}
+	for _, fe := range p.Errors {
+		f.Fields = append(f.Fields, tools.FieldFailure{Field: fe.Field, Message: fe.Message})
+	}
+	return f
+}
+
+type ListMyEnrollmentsArgs struct {
+	UserEmail string `json:"user_email"`
+}
+
+func (s Server) ListMyEnrollments(ctx context.Context, fc *genai.FunctionCall, args ListMyEnrollmentsArgs) (map[string]any, error) {
+	enrollments, err := courses.ListEnrollments(ctx, args.UserEmail)
+	if err != nil {
+		return nil, err
+	}
+	var em []map[string]any
+	b, _ := json.Marshal(enrollments)
+	err = json.Unmarshal(b, &em)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Interface("enrollments", em).Msg("checking enrollments")
+	return map[string]any{
+		"enrollments": em,
+	}, nil
+}
+
+type GetOrderArgs struct {
+	OrderNumber string `json:"order_number"`
+}
+
+func (s Server) GetOrder(ctx context.Context, fc *genai.FunctionCall, args GetOrderArgs) (map[string]any, error) {
+	o, err := courses.GetOrder(ctx, args.OrderNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -46,29 +94,56 @@ func (s Server) GetOrder(ctx context.Context, fc *genai.FunctionCall) (*genai.Fu
 		return nil, err
 	}
 	log.Debug().Interface("order", om).Msg("checking order")
-	fr := &genai.FunctionResponse{
-		Name: "get_order",
-		Response: map[string]interface{}{
-			"order": om,
-		},
-	}
-	return fr, nil
+	return map[string]any{
+		"order": om,
+	}, nil
 }
 
-func (s Server) CreateOrder(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
-	course, ok := fc.Args["course"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing course")
-	}
-	userName, ok := fc.Args["user_name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing user name")
+type ListOrdersArgs struct {
+	UserEmail string              `json:"user_email"`
+	Status    courses.OrderStatus `json:"status"`
+}
+
+func (s Server) ListOrders(ctx context.Context, fc *genai.FunctionCall, args ListOrdersArgs) (map[string]any, error) {
+	res, err := courses.ListOrders(ctx, courses.ListOrdersOptions{
+		UserEmail: args.UserEmail,
+		Status:    args.Status,
+	})
+	if err != nil {
+		return nil, err
 	}
-	userEmail, ok := fc.Args["user_email"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing user email")
+	var om []map[string]any
+	b, _ := json.Marshal(res.Orders)
+	err = json.Unmarshal(b, &om)
+	if err != nil {
+		return nil, err
 	}
-	o, err := courses.CreateOrder(ctx, course, userName, userEmail)
+	log.Debug().Interface("orders", om).Msg("checking orders")
+	return map[string]any{
+		"orders": om,
+	}, nil
+}
+
+type CreateOrderArgs struct {
+	Course     string `json:"course"`
+	Quantity   int    `json:"quantity"`
+	UserName   string `json:"user_name"`
+	UserEmail  string `json:"user_email"`
+	CouponCode string `json:"coupon_code"`
+	Currency   string `json:"currency"`
+	Country    string `json:"country"`
+}
+
+func (s Server) CreateOrder(ctx context.Context, fc *genai.FunctionCall, args CreateOrderArgs) (map[string]any, error) {
+	o, err := courses.CreateOrder(ctx, courses.CreateOrderRequest{
+		Course:     args.Course,
+		Quantity:   args.Quantity,
+		UserName:   args.UserName,
+		UserEmail:  args.UserEmail,
+		CouponCode: args.CouponCode,
+		Currency:   args.Currency,
+		Country:    args.Country,
+	}, orderIdempotencyKey(fc))
 	if err != nil {
 		return nil, err
 	}
@@ -81,25 +156,44 @@ func (s Server) CreateOrder(ctx context.Context, fc *genai.FunctionCall) (*genai
 	}
 	log.Debug().Interface("order", om).Msg("checking order")
 
-	paymentUrl := fmt.Sprintf("http://localhost:8080/orders/%s/payment", o.ID)
-	log.Info().Str("payment_url", paymentUrl).Msg("payment url")
-
-	return &genai.FunctionResponse{
-		Name: "create_order",
-		Response: map[string]interface{}{
-			"order":       om,
-			"payment_url": paymentUrl,
+	resp := map[string]any{
+		"order": om,
+		"tax_breakdown": map[string]interface{}{
+			"currency": o.Currency,
+			"subtotal": o.Subtotal,
+			"tax_name": o.TaxName,
+			"tax_rate": o.TaxRate,
+			"tax":      o.Tax,
+			"total":    o.Total,
 		},
-	}, nil
+	}
+	// The courses API owns the payment page; a made up link would send
+	// the user nowhere.
+	if o.PaymentURL == "" {
+		log.Warn().Str("order", o.ID).Msg("order without payment url")
+		resp["message"] = "The order was created, but the courses API returned no payment link for it. Tell the user the order ID and do not make up a link."
+	} else {
+		log.Info().Str("payment_url", o.PaymentURL).Msg("payment url")
+		resp["payment_url"] = o.PaymentURL
+	}
+	return resp, nil
 }
 
-func (s Server) GetCourse(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
-	course, ok := fc.Args["course"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing course")
+// orderIdempotencyKey derives the Idempotency-Key for a create_order call
+// from the tool call ID, so the same call is never turned into two orders.
+func orderIdempotencyKey(fc *genai.FunctionCall) string {
+	if fc.ID == "" {
+		return ""
 	}
+	return "create_order:" + fc.ID
+}
+
+type GetCourseArgs struct {
+	Course string `json:"course"`
+}
 
-	c, err := courses.GetCourse(ctx, course)
+func (s Server) GetCourse(ctx context.Context, fc *genai.FunctionCall, args GetCourseArgs) (map[string]any, error) {
+	c, err := courses.GetCourse(ctx, args.Course)
 	if err != nil {
 		return nil, err
 	}
@@ -110,17 +204,17 @@ func (s Server) GetCourse(ctx context.Context, fc *genai.FunctionCall) (*genai.F
 		return nil, err
 	}
 	log.Debug().Interface("course", cm).Msg("checking course")
-	fr := &genai.FunctionResponse{
-		Name: "get_course",
-		Response: map[string]interface{}{
-			"course": cm,
-		},
-	}
-	return fr, nil
+	return map[string]any{
+		"course": cm,
+	}, nil
 }
 
-func (s Server) ListCourses(ctx context.Context) (*genai.FunctionResponse, error) {
-	courses, err := courses.ListCourse(ctx)
+type ListCoursesArgs struct {
+	Query string `json:"query"`
+}
+
+func (s Server) ListCourses(ctx context.Context, fc *genai.FunctionCall, args ListCoursesArgs) (map[string]any, error) {
+	courses, err := courses.ListCourse(ctx, args.Query)
 	if err != nil {
 		return nil, err
 	}
@@ -131,17 +225,17 @@ func (s Server) ListCourses(ctx context.Context) (*genai.FunctionResponse, error
 		return nil, err
 	}
 	log.Debug().Interface("courses", coursesM).Msg("checking courses")
-	fr := &genai.FunctionResponse{
-		Name: "list_courses",
-		Response: map[string]interface{}{
-			"courses": coursesM,
-		},
-	}
-	return fr, nil
+	return map[string]any{
+		"courses": coursesM,
+	}, nil
+}
+
+type SearchCourseContentArgs struct {
+	Query string `json:"query"`
 }
 
-func (s Server) SearchCourseContent(ctx context.Context, query string) (*genai.FunctionResponse, error) {
-	resp, err := s.EmbeddingModel.EmbedContent(ctx, gogenai.Text(query))
+func (s Server) SearchCourseContent(ctx context.Context, fc *genai.FunctionCall, args SearchCourseContentArgs) (map[string]any, error) {
+	resp, err := s.EmbeddingModel.EmbedContent(ctx, gogenai.Text(args.Query))
 	if err != nil {
 		return nil, err
 	}
@@ -149,11 +243,7 @@ func (s Server) SearchCourseContent(ctx context.Context, query string) (*genai.F
 	if err != nil {
 		return nil, err
 	}
-	fr := &genai.FunctionResponse{
-		Name: "search_course_content",
-		Response: map[string]interface{}{
-			"contents": data,
-		},
-	}
-	return fr, nil
+	return map[string]any{
+		"contents": data,
+	}, nil
 }
@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// CodeActionNotFound is the failure code of confirmations for an action
+// that does not exist, has expired or already ran.
+const CodeActionNotFound = "action_not_found"
+
+// pendingActionTTL is how long a held action waits for its confirmation.
+const pendingActionTTL = 5 * time.Minute
+
+// ConfirmActionDeclaration is offered to the model when a registry has
+// tools that require confirmation.
+var ConfirmActionDeclaration = &genai.FunctionDeclaration{
+	Name:        "confirm_action",
+	Description: "Run an action that is waiting for the user's confirmation, such as creating an order. Only call this after you read the action back to the user and the user clearly agreed to it. Never confirm an action on your own.",
+	Parameters: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"action_token": {
+				Type:        genai.TypeString,
+				Description: "action_token returned by the tool that asked for confirmation.",
+			},
+		},
+		Required: []string{"action_token"},
+	},
+}
+
+// PendingAction is a call of a tool that requires confirmation, held until
+// the user approves it.
+type PendingAction struct {
+	Token string `json:"token"`
+	// ID is the ID of the held function call.
+	ID        string         `json:"id,omitempty"`
+	Name      string         `json:"name"`
+	Args      map[string]any `json:"args"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+
+	call *genai.FunctionCall
+}
+
+// hold validates the call and keeps it as a pending action. The model is
+// answered with the action token to confirm it with.
+func (r *Runner) hold(fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
+	if err := Validate(r.registry.tools[fc.Name].decl.Parameters, fc.Args); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	action := &PendingAction{
+		Token:     hex.EncodeToString(b),
+		ID:        fc.ID,
+		Name:      fc.Name,
+		Args:      fc.Args,
+		ExpiresAt: time.Now().Add(pendingActionTTL),
+		call:      fc,
+	}
+
+	r.mu.Lock()
+	for token, a := range r.pending {
+		if time.Now().After(a.ExpiresAt) {
+			delete(r.pending, token)
+		}
+	}
+	r.pending[action.Token] = action
+	r.mu.Unlock()
+
+	if r.OnHold != nil {
+		r.OnHold(*action)
+	}
+	return &genai.FunctionResponse{
+		ID:   fc.ID,
+		Name: fc.Name,
+		Response: map[string]any{
+			"status":       "confirmation_required",
+			"action_token": action.Token,
+			"message":      "Nothing has been done yet. Read the details back to the user and ask them to confirm. Call confirm_action with the action_token only once they agree; the user may also approve it in the app.",
+		},
+	}, nil
+}
+
+// take removes the pending action with the token and returns it, or nil
+// when there is none or it has expired.
+func (r *Runner) take(token string) *PendingAction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	action, ok := r.pending[token]
+	if !ok {
+		return nil
+	}
+	delete(r.pending, token)
+	if time.Now().After(action.ExpiresAt) {
+		return nil
+	}
+	return action
+}
+
+// pendingName returns the tool name of the pending action with the token.
+func (r *Runner) pendingName(token string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if action, ok := r.pending[token]; ok {
+		return action.Name
+	}
+	return ""
+}
+
+// confirm runs the pending action named by a confirm_action call. The
+// action runs with the call that was held, so its ID is the one the
+// handler saw when it asked for confirmation.
+func (r *Runner) confirm(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
+	if err := Validate(ConfirmActionDeclaration.Parameters, fc.Args); err != nil {
+		return nil, err
+	}
+	token, _ := fc.Args["action_token"].(string)
+	action := r.take(token)
+	if action == nil {
+		return nil, &Failure{
+			Code:    CodeActionNotFound,
+			Message: "There is no pending action with this token; it may have expired, been declined or already run",
+		}
+	}
+	fr, err := r.registry.Dispatch(ctx, action.call)
+	if err != nil {
+		return nil, err
+	}
+	return &genai.FunctionResponse{
+		ID:   fc.ID,
+		Name: fc.Name,
+		Response: map[string]any{
+			"action": action.Name,
+			"result": fr.Response,
+		},
+	}, nil
+}
+
+// Approve runs the pending action with the token, for approvals made by
+// the user in the client rather than through the model. The result is the
+// one a confirm_action call would get.
+func (r *Runner) Approve(ctx context.Context, token string) Result {
+	return r.run(ctx, &genai.FunctionCall{
+		Name: ConfirmActionDeclaration.Name,
+		Args: map[string]any{"action_token": token},
+	})
+}
+
+// Decline drops the pending action with the token and returns it, or nil
+// when there is none.
+func (r *Runner) Decline(token string) *PendingAction {
+	return r.take(token)
+}
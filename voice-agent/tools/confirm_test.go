@@ -0,0 +1,188 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// newConfirmTest returns a runner whose "wait" tool requires confirmation
+// and records the actions it holds.
+func newConfirmTest(tool *blockingTool, opts ...Option) (*Runner, *[]PendingAction) {
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle, append(opts, RequiresConfirmation())...)
+	runner := NewRunner(registry, 2, time.Minute, nil)
+	held := &[]PendingAction{}
+	runner.OnHold = func(action PendingAction) {
+		*held = append(*held, action)
+	}
+	return runner, held
+}
+
+// holdCall runs a call of the "wait" tool and returns the token of the
+// action it was held as.
+func holdCall(t *testing.T, runner *Runner, id, key string) string {
+	t.Helper()
+	res := runner.Run(context.Background(), []*genai.FunctionCall{waitCall(id, key)})[0]
+	if !res.Held || res.Failure != nil {
+		t.Fatalf("result = %+v, want a held call", res)
+	}
+	if res.Response.ID != id || res.Response.Response["status"] != "confirmation_required" {
+		t.Fatalf("response = %+v, want confirmation_required for %s", res.Response, id)
+	}
+	token, _ := res.Response.Response["action_token"].(string)
+	if token == "" {
+		t.Fatal("response has no action_token")
+	}
+	return token
+}
+
+func confirmCall(id, token string) *genai.FunctionCall {
+	return &genai.FunctionCall{ID: id, Name: ConfirmActionDeclaration.Name, Args: map[string]any{"action_token": token}}
+}
+
+func wantActionNotFound(t *testing.T, res Result) {
+	t.Helper()
+	if res.Failure == nil || res.Failure.Code != CodeActionNotFound {
+		t.Errorf("failure = %+v, want %s", res.Failure, CodeActionNotFound)
+	}
+}
+
+func TestHoldAndConfirm(t *testing.T) {
+	tool := newBlockingTool("a")
+	close(tool.release["a"])
+	runner, held := newConfirmTest(tool)
+
+	token := holdCall(t, runner, "1", "a")
+	if len(tool.started) != 0 {
+		t.Fatal("a held call ran before it was confirmed")
+	}
+	if len(*held) != 1 {
+		t.Fatalf("OnHold called %d times, want 1", len(*held))
+	}
+	action := (*held)[0]
+	if action.Token != token || action.ID != "1" || action.Name != "wait" || action.Args["key"] != "a" {
+		t.Errorf("held action = %+v, want call 1 with token %s", action, token)
+	}
+	if ttl := time.Until(action.ExpiresAt); ttl <= 0 || ttl > pendingActionTTL {
+		t.Errorf("action expires in %v, want within %v", ttl, pendingActionTTL)
+	}
+
+	res := runner.Run(context.Background(), []*genai.FunctionCall{confirmCall("2", token)})[0]
+	if res.Failure != nil || res.Held {
+		t.Fatalf("confirm result = %+v, want a response", res)
+	}
+	if res.Response.ID != "2" || res.Response.Name != ConfirmActionDeclaration.Name {
+		t.Errorf("confirm answered %s %s, want confirm_action 2", res.Response.Name, res.Response.ID)
+	}
+	if res.Response.Response["action"] != "wait" {
+		t.Errorf("action = %v, want wait", res.Response.Response["action"])
+	}
+	if result, _ := res.Response.Response["result"].(map[string]any); result["key"] != "a" {
+		t.Errorf("result = %v, want the handler's response", res.Response.Response["result"])
+	}
+	tool.waitStarted(t, 1)
+
+	// An action runs at most once.
+	wantActionNotFound(t, runner.Run(context.Background(), []*genai.FunctionCall{confirmCall("3", token)})[0])
+}
+
+func TestConfirmUnknownToken(t *testing.T) {
+	runner, _ := newConfirmTest(newBlockingTool())
+	wantActionNotFound(t, runner.Run(context.Background(), []*genai.FunctionCall{confirmCall("1", "unknown")})[0])
+}
+
+func TestApproveAndDecline(t *testing.T) {
+	tool := newBlockingTool("approved", "declined")
+	close(tool.release["approved"])
+	runner, _ := newConfirmTest(tool)
+
+	approved := holdCall(t, runner, "1", "approved")
+	declined := holdCall(t, runner, "2", "declined")
+
+	res := runner.Approve(context.Background(), approved)
+	if res.Failure != nil || res.Response == nil || res.Response.Response["action"] != "wait" {
+		t.Fatalf("Approve() = %+v, want the action's result", res)
+	}
+	if keys := tool.waitStarted(t, 1); keys[0] != "approved" {
+		t.Errorf("ran %s, want approved", keys[0])
+	}
+
+	action := runner.Decline(declined)
+	if action == nil || action.ID != "2" || action.Name != "wait" {
+		t.Fatalf("Decline() = %+v, want call 2", action)
+	}
+	if runner.Decline(declined) != nil {
+		t.Error("Decline() returned an action declined before")
+	}
+	wantActionNotFound(t, runner.Approve(context.Background(), declined))
+	if len(tool.started) != 0 {
+		t.Error("a declined action ran")
+	}
+}
+
+func TestConfirmExpiredAction(t *testing.T) {
+	tool := newBlockingTool("a")
+	close(tool.release["a"])
+	runner, _ := newConfirmTest(tool)
+
+	token := holdCall(t, runner, "1", "a")
+	runner.mu.Lock()
+	runner.pending[token].ExpiresAt = time.Now().Add(-time.Second)
+	runner.mu.Unlock()
+
+	wantActionNotFound(t, runner.Approve(context.Background(), token))
+	if len(tool.started) != 0 {
+		t.Error("an expired action ran")
+	}
+
+	// Expired actions are dropped when the next one is held.
+	expired := holdCall(t, runner, "2", "a")
+	runner.mu.Lock()
+	runner.pending[expired].ExpiresAt = time.Now().Add(-time.Second)
+	runner.mu.Unlock()
+	holdCall(t, runner, "3", "a")
+	runner.mu.Lock()
+	_, ok := runner.pending[expired]
+	runner.mu.Unlock()
+	if ok {
+		t.Error("expired action still pending after holding another one")
+	}
+}
+
+func TestConfirmTimeoutOutcomeUnknown(t *testing.T) {
+	tool := newBlockingTool("slow")
+	runner, _ := newConfirmTest(tool, WithTimeout(20*time.Millisecond))
+
+	token := holdCall(t, runner, "1", "slow")
+	res := runner.Approve(context.Background(), token)
+	if f := res.Failure; f == nil || f.Code != CodeOutcomeUnknown || f.Retryable {
+		t.Errorf("failure = %+v, want a non-retryable %s", f, CodeOutcomeUnknown)
+	}
+	if res.Response == nil || res.Response.Name != ConfirmActionDeclaration.Name {
+		t.Errorf("response = %+v, want the failure for confirm_action", res.Response)
+	}
+}
+
+func TestCancelDropsHeldAction(t *testing.T) {
+	tool := newBlockingTool("cancelled", "kept")
+	close(tool.release["kept"])
+	runner, _ := newConfirmTest(tool)
+
+	cancelled := holdCall(t, runner, "1", "cancelled")
+	kept := holdCall(t, runner, "2", "kept")
+
+	dropped := runner.Cancel([]string{"1", "unknown"})
+	if len(dropped) != 1 || dropped[0].Token != cancelled || dropped[0].ID != "1" {
+		t.Fatalf("Cancel() = %+v, want the action of call 1", dropped)
+	}
+	wantActionNotFound(t, runner.Approve(context.Background(), cancelled))
+	if res := runner.Approve(context.Background(), kept); res.Failure != nil {
+		t.Errorf("kept action failed: %v", res.Failure)
+	}
+	if keys := tool.waitStarted(t, 1); keys[0] != "kept" {
+		t.Errorf("ran %s, want kept", keys[0])
+	}
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genai"
+)
+
+// Failure codes of errors that did not come with a code of their own.
+const (
+	CodeInvalidArguments = "invalid_arguments"
+	CodeUnknownTool      = "unknown_tool"
+	CodeTimeout          = "timeout"
+	CodeToolFailed       = "tool_failed"
+	// CodeOutcomeUnknown is reported for confirmed actions that timed out
+	// or failed unexpectedly, which may have taken effect anyway. It is
+	// never retryable.
+	CodeOutcomeUnknown = "outcome_unknown"
+)
+
+// Failure is what the model is told when a tool call fails, so it can
+// apologise, fix its arguments or try again. Handlers may return a
+// *Failure to pick the code and message themselves.
+type Failure struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Retryable reports whether the same call may succeed if it is made
+	// again, e.g. after a timeout.
+	Retryable bool           `json:"retryable"`
+	Fields    []FieldFailure `json:"fields,omitempty"`
+}
+
+// FieldFailure names an argument the call got wrong.
+type FieldFailure struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (f *Failure) Error() string {
+	return f.Code + ": " + f.Message
+}
+
+// Response returns the function response reporting the failure of fc.
+func (f *Failure) Response(fc *genai.FunctionCall) *genai.FunctionResponse {
+	return &genai.FunctionResponse{
+		ID:   fc.ID,
+		Name: fc.Name,
+		Response: map[string]any{
+			"error": f,
+		},
+	}
+}
+
+// AsFailure describes err as a Failure. Errors without a code of their own
+// get tool_failed and a message that does not leak their text, since it
+// may be read out to the user.
+func AsFailure(err error) *Failure {
+	var f *Failure
+	var ae *ArgumentError
+	var ue *UnknownToolError
+	switch {
+	case errors.As(err, &f):
+		return f
+	case errors.As(err, &ae):
+		f := &Failure{Code: CodeInvalidArguments, Message: ae.Error()}
+		if ae.Field != "" {
+			f.Fields = []FieldFailure{{Field: ae.Field, Message: ae.Message}}
+		}
+		return f
+	case errors.As(err, &ue):
+		return &Failure{Code: CodeUnknownTool, Message: ue.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Failure{Code: CodeTimeout, Message: "The tool took too long to answer", Retryable: true}
+	}
+	return &Failure{Code: CodeToolFailed, Message: "The tool failed unexpectedly", Retryable: true}
+}
@@ -0,0 +1,157 @@
+// Package tools pairs the function declarations given to a live model
+// with the Go handlers that run them.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Handler runs a function call whose arguments were decoded into A.
+type Handler[A any] func(ctx context.Context, fc *genai.FunctionCall, args A) (map[string]any, error)
+
+type tool struct {
+	decl    *genai.FunctionDeclaration
+	run     func(ctx context.Context, fc *genai.FunctionCall) (map[string]any, error)
+	timeout time.Duration
+	// confirm holds calls until the user approves them.
+	confirm bool
+}
+
+// Option configures a registered tool.
+type Option func(*tool)
+
+// WithTimeout limits how long a call of the tool may run. Without it the
+// runner's default applies.
+func WithTimeout(d time.Duration) Option {
+	return func(t *tool) {
+		t.timeout = d
+	}
+}
+
+// Registry holds the tools a session offers to the model.
+type Registry struct {
+	tools map[string]*tool
+	// names keeps the registration order so declarations are stable.
+	names []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]*tool{}}
+}
+
+// Register adds a tool. Calls are validated against the parameters of decl
+// and decoded into A with encoding/json, so the fields of A need json tags
+// matching the parameter names. It panics when the name is taken.
+func Register[A any](r *Registry, decl *genai.FunctionDeclaration, h Handler[A], opts ...Option) {
+	if _, ok := r.tools[decl.Name]; ok || decl.Name == ConfirmActionDeclaration.Name {
+		panic(fmt.Sprintf("tools: %s registered twice", decl.Name))
+	}
+	t := &tool{
+		decl: decl,
+		run: func(ctx context.Context, fc *genai.FunctionCall) (map[string]any, error) {
+			if err := Validate(decl.Parameters, fc.Args); err != nil {
+				return nil, err
+			}
+			var args A
+			b, err := json.Marshal(fc.Args)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, &args); err != nil {
+				return nil, &ArgumentError{Message: err.Error()}
+			}
+			return h(ctx, fc, args)
+		},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	r.tools[decl.Name] = t
+	r.names = append(r.names, decl.Name)
+}
+
+// Tools returns the declarations of every registered tool, for
+// genai.LiveConnectConfig.Tools. confirm_action is added when a tool
+// requires confirmation.
+func (r *Registry) Tools() []*genai.Tool {
+	if len(r.names) == 0 {
+		return nil
+	}
+	decls := make([]*genai.FunctionDeclaration, 0, len(r.names)+1)
+	confirm := false
+	for _, name := range r.names {
+		decls = append(decls, r.tools[name].decl)
+		confirm = confirm || r.tools[name].confirm
+	}
+	if confirm {
+		decls = append(decls, ConfirmActionDeclaration)
+	}
+	return []*genai.Tool{{FunctionDeclarations: decls}}
+}
+
+// Names returns the names of the functions the model may call, in the
+// order of Tools.
+func (r *Registry) Names() []string {
+	names := []string{}
+	for _, t := range r.Tools() {
+		for _, decl := range t.FunctionDeclarations {
+			names = append(names, decl.Name)
+		}
+	}
+	return names
+}
+
+func (r *Registry) timeout(name string) time.Duration {
+	if t, ok := r.tools[name]; ok {
+		return t.timeout
+	}
+	return 0
+}
+
+// RequiresConfirmation marks a tool with side effects, such as spending the
+// user's money. Its calls are held by the runner until the user confirms
+// them, either through the confirm_action tool or in the client.
+func RequiresConfirmation() Option {
+	return func(t *tool) {
+		t.confirm = true
+	}
+}
+
+func (r *Registry) requiresConfirmation(name string) bool {
+	t, ok := r.tools[name]
+	return ok && t.confirm
+}
+
+// Dispatch validates the call's arguments and runs its handler, without
+// asking for confirmation; sessions dispatch through a Runner. It returns
+// an *UnknownToolError for names that were never registered and an
+// *ArgumentError for arguments that do not match the declaration.
+func (r *Registry) Dispatch(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
+	t, ok := r.tools[fc.Name]
+	if !ok {
+		return nil, &UnknownToolError{Name: fc.Name}
+	}
+	res, err := t.run(ctx, fc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fc.Name, err)
+	}
+	return &genai.FunctionResponse{
+		ID:       fc.ID,
+		Name:     fc.Name,
+		Response: res,
+	}, nil
+}
+
+// UnknownToolError is returned for calls to a tool that is not registered.
+type UnknownToolError struct {
+	Name string
+}
+
+func (e *UnknownToolError) Error() string {
+	return "unknown function " + e.Name
+}
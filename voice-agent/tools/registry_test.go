@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"voice-agent/courses"
+
+	"google.golang.org/genai"
+)
+
+type searchArgs struct {
+	Query string `json:"query"`
+}
+
+func TestRegisterDecodesArguments(t *testing.T) {
+	r := NewRegistry()
+	var got searchArgs
+	Register(r, courses.SearchCourseContentDeclaration, func(ctx context.Context, fc *genai.FunctionCall, args searchArgs) (map[string]any, error) {
+		got = args
+		return map[string]any{"content": "found"}, nil
+	})
+
+	fc := &genai.FunctionCall{ID: "call-1", Name: "search_course_content", Args: map[string]any{"query": "xss"}}
+	res, err := r.Dispatch(context.Background(), fc)
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if got.Query != "xss" {
+		t.Errorf("handler got query %q, want %q", got.Query, "xss")
+	}
+	if res.ID != fc.ID || res.Name != fc.Name || res.Response["content"] != "found" {
+		t.Errorf("Dispatch() = %+v, want the handler's response for %s", res, fc.ID)
+	}
+}
+
+func TestDispatchRejectsInvalidArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantField string
+	}{
+		// Used to panic on the type assertion in the handler.
+		{name: "query not a string", args: map[string]any{"query": float64(42)}, wantField: "query"},
+		{name: "query missing", args: map[string]any{}, wantField: "query"},
+		{name: "unknown argument", args: map[string]any{"query": "xss", "limit": float64(3)}, wantField: "limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			called := false
+			Register(r, courses.SearchCourseContentDeclaration, func(ctx context.Context, fc *genai.FunctionCall, args searchArgs) (map[string]any, error) {
+				called = true
+				return nil, nil
+			})
+
+			_, err := r.Dispatch(context.Background(), &genai.FunctionCall{Name: "search_course_content", Args: tt.args})
+			var ae *ArgumentError
+			if !errors.As(err, &ae) {
+				t.Fatalf("Dispatch() error = %v, want an *ArgumentError", err)
+			}
+			if ae.Field != tt.wantField {
+				t.Errorf("field = %q, want %q", ae.Field, tt.wantField)
+			}
+			if called {
+				t.Error("handler was called with invalid arguments")
+			}
+			if f := AsFailure(err); f.Code != CodeInvalidArguments || f.Retryable {
+				t.Errorf("AsFailure() = %+v, want a non-retryable %s", f, CodeInvalidArguments)
+			}
+		})
+	}
+}
+
+func TestDispatchDecodeError(t *testing.T) {
+	r := NewRegistry()
+	// The schema allows any number, but the handler wants an int.
+	decl := &genai.FunctionDeclaration{
+		Name: "seats",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"quantity": {Type: genai.TypeNumber}},
+		},
+	}
+	Register(r, decl, func(ctx context.Context, fc *genai.FunctionCall, args struct {
+		Quantity int `json:"quantity"`
+	}) (map[string]any, error) {
+		return nil, nil
+	})
+
+	_, err := r.Dispatch(context.Background(), &genai.FunctionCall{Name: "seats", Args: map[string]any{"quantity": 1.5}})
+	var ae *ArgumentError
+	if !errors.As(err, &ae) {
+		t.Fatalf("Dispatch() error = %v, want an *ArgumentError", err)
+	}
+}
+
+func TestDispatchUnknownTool(t *testing.T) {
+	_, err := NewRegistry().Dispatch(context.Background(), &genai.FunctionCall{Name: "delete_everything"})
+	var ue *UnknownToolError
+	if !errors.As(err, &ue) || ue.Name != "delete_everything" {
+		t.Fatalf("Dispatch() error = %v, want an *UnknownToolError", err)
+	}
+	if f := AsFailure(err); f.Code != CodeUnknownTool {
+		t.Errorf("AsFailure() code = %s, want %s", f.Code, CodeUnknownTool)
+	}
+}
+
+func TestRegisterPanicsOnDuplicateName(t *testing.T) {
+	noop := func(ctx context.Context, fc *genai.FunctionCall, args searchArgs) (map[string]any, error) {
+		return nil, nil
+	}
+	tests := []struct {
+		name string
+		decl *genai.FunctionDeclaration
+	}{
+		{name: "registered twice", decl: courses.SearchCourseContentDeclaration},
+		{name: "confirm_action", decl: &genai.FunctionDeclaration{Name: ConfirmActionDeclaration.Name}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			Register(r, courses.SearchCourseContentDeclaration, noop)
+
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%s) did not panic", tt.decl.Name)
+				}
+			}()
+			Register(r, tt.decl, noop)
+		})
+	}
+}
+
+func TestRegistryTools(t *testing.T) {
+	noop := func(ctx context.Context, fc *genai.FunctionCall, args map[string]any) (map[string]any, error) {
+		return nil, nil
+	}
+
+	r := NewRegistry()
+	if r.Tools() != nil {
+		t.Errorf("Tools() of an empty registry = %v, want nil", r.Tools())
+	}
+
+	Register(r, courses.ListCoursesDeclaration, noop)
+	Register(r, courses.GetCourseDeclaration, noop, WithTimeout(3))
+	if want := []string{"list_courses", "get_course"}; !slices.Equal(r.Names(), want) {
+		t.Errorf("Names() = %v, want %v", r.Names(), want)
+	}
+	if r.timeout("get_course") != 3 || r.timeout("list_courses") != 0 {
+		t.Errorf("timeouts = %v, %v, want 3, 0", r.timeout("get_course"), r.timeout("list_courses"))
+	}
+
+	// confirm_action is only offered once a tool needs confirmation.
+	Register(r, courses.CreateOrderDeclaration, noop, RequiresConfirmation())
+	if want := []string{"list_courses", "get_course", "create_order", ConfirmActionDeclaration.Name}; !slices.Equal(r.Names(), want) {
+		t.Errorf("Names() = %v, want %v", r.Names(), want)
+	}
+	if !r.requiresConfirmation("create_order") || r.requiresConfirmation("get_course") {
+		t.Error("requiresConfirmation does not match the registered options")
+	}
+}
@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genai"
+)
+
+// errCancelled is the cause of calls the model cancelled.
+var errCancelled = errors.New("function call cancelled")
+
+// Result is the outcome of one function call. Response is nil when the
+// model cancelled the call, since cancelled calls must not be answered.
+type Result struct {
+	Response *genai.FunctionResponse
+	// Failure is set when the call failed; Response then reports it.
+	Failure *Failure
+	// Held reports that the call waits for the user's confirmation.
+	Held bool
+}
+
+// Runner runs the function calls of one live session. Calls run
+// concurrently, at most MaxConcurrent at a time across the whole session,
+// each with the timeout of its tool.
+type Runner struct {
+	registry *Registry
+	// describe turns handler errors into failures for the model.
+	describe func(error) *Failure
+	timeout  time.Duration
+	sem      chan struct{}
+
+	// OnHold, when set, is called with every action that waits for the
+	// user's confirmation, so the client can offer to approve it.
+	OnHold func(PendingAction)
+
+	mu sync.Mutex
+	// cancels holds the running calls by ID.
+	cancels map[string]context.CancelCauseFunc
+	// pending holds the actions waiting for confirmation by token.
+	pending map[string]*PendingAction
+}
+
+// NewRunner returns a runner for the tools of registry. Calls of tools
+// registered without a timeout get timeout. describe may be nil, AsFailure
+// is used then.
+func NewRunner(registry *Registry, maxConcurrent int, timeout time.Duration, describe func(error) *Failure) *Runner {
+	if describe == nil {
+		describe = AsFailure
+	}
+	return &Runner{
+		registry: registry,
+		describe: describe,
+		timeout:  timeout,
+		sem:      make(chan struct{}, max(maxConcurrent, 1)),
+		cancels:  map[string]context.CancelCauseFunc{},
+		pending:  map[string]*PendingAction{},
+	}
+}
+
+// Run runs calls and returns their results in call order, once every call
+// has finished, failed, timed out or been cancelled.
+func (r *Runner) Run(ctx context.Context, calls []*genai.FunctionCall) []Result {
+	results := make([]Result, len(calls))
+	var wg sync.WaitGroup
+	for i, fc := range calls {
+		callCtx, cancel := context.WithCancelCause(ctx)
+		r.track(fc.ID, cancel)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.untrack(fc.ID)
+			defer cancel(nil)
+			results[i] = r.run(callCtx, fc)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Cancel stops the running calls with the given IDs. Their results are
+// left without a response. Held calls with those IDs can no longer be
+// confirmed; they are dropped and returned so the client can be told.
+func (r *Runner) Cancel(ids []string) []PendingAction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if cancel, ok := r.cancels[id]; ok {
+			cancel(errCancelled)
+		}
+	}
+
+	var dropped []PendingAction
+	for token, action := range r.pending {
+		if action.ID != "" && slices.Contains(ids, action.ID) {
+			delete(r.pending, token)
+			dropped = append(dropped, *action)
+		}
+	}
+	return dropped
+}
+
+func (r *Runner) track(id string, cancel context.CancelCauseFunc) {
+	// Calls without an ID cannot be cancelled by the model.
+	if id == "" {
+		return
+	}
+	r.mu.Lock()
+	r.cancels[id] = cancel
+	r.mu.Unlock()
+}
+
+func (r *Runner) untrack(id string) {
+	if id == "" {
+		return
+	}
+	r.mu.Lock()
+	delete(r.cancels, id)
+	r.mu.Unlock()
+}
+
+func (r *Runner) run(ctx context.Context, fc *genai.FunctionCall) Result {
+	select {
+	case r.sem <- struct{}{}:
+		defer func() { <-r.sem }()
+	case <-ctx.Done():
+		return r.result(ctx, fc, nil, ctx.Err(), false)
+	}
+
+	name := fc.Name
+	if name == ConfirmActionDeclaration.Name {
+		// Confirmed actions get the timeout of the tool they run.
+		token, _ := fc.Args["action_token"].(string)
+		name = r.pendingName(token)
+	}
+	// Once a confirmed action runs, a timeout or an unexpected error no
+	// longer tells whether it took effect.
+	confirming := fc.Name == ConfirmActionDeclaration.Name && name != ""
+	timeout := r.registry.timeout(name)
+	if timeout == 0 {
+		timeout = r.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type dispatched struct {
+		fr  *genai.FunctionResponse
+		err error
+	}
+	// Handlers that ignore ctx are left to finish in the background, so
+	// they cannot hold up the other results.
+	done := make(chan dispatched, 1)
+	go func() {
+		fr, err := r.dispatch(ctx, fc)
+		done <- dispatched{fr, err}
+	}()
+	select {
+	case d := <-done:
+		return r.result(ctx, fc, d.fr, d.err, confirming)
+	case <-ctx.Done():
+		return r.result(ctx, fc, nil, ctx.Err(), confirming)
+	}
+}
+
+// dispatch runs the call, holding it instead when its tool requires
+// confirmation.
+func (r *Runner) dispatch(ctx context.Context, fc *genai.FunctionCall) (*genai.FunctionResponse, error) {
+	switch {
+	case fc.Name == ConfirmActionDeclaration.Name:
+		return r.confirm(ctx, fc)
+	case r.registry.requiresConfirmation(fc.Name):
+		return r.hold(fc)
+	}
+	return r.registry.Dispatch(ctx, fc)
+}
+
+// result describes the outcome of fc. confirming is set for confirm_action
+// calls that ran their action.
+func (r *Runner) result(ctx context.Context, fc *genai.FunctionCall, fr *genai.FunctionResponse, err error, confirming bool) Result {
+	if errors.Is(context.Cause(ctx), errCancelled) {
+		log.Debug().Str("name", fc.Name).Str("id", fc.ID).Msg("function call cancelled")
+		return Result{}
+	}
+	if err == nil {
+		return Result{Response: fr, Held: r.registry.requiresConfirmation(fc.Name)}
+	}
+	f := r.describe(err)
+	if confirming && (f.Code == CodeTimeout || f.Code == CodeToolFailed) {
+		// Retrying would need a new confirmation, and with it a new
+		// call that the action's idempotency does not cover.
+		f = &Failure{
+			Code:    CodeOutcomeUnknown,
+			Message: "The action did not answer in time and may or may not have been done. Do not try it again; tell the user and check its outcome, e.g. by listing their orders",
+		}
+	}
+	log.Warn().Err(err).Str("name", fc.Name).Str("id", fc.ID).Str("code", f.Code).Msg("function call failed")
+	return Result{Response: f.Response(fc), Failure: f}
+}
+
+// FailureBudget ends sessions whose tool calls keep failing, so a model
+// retrying broken calls forever does not keep the session open. Failures
+// count for the whole session, successful calls in between do not reset
+// them.
+type FailureBudget struct {
+	// Max is how many calls may fail in a session.
+	Max int
+
+	mu       sync.Mutex
+	failures int
+}
+
+// Record counts the failed results and reports whether the budget is
+// exhausted.
+func (b *FailureBudget) Record(results []Result) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, res := range results {
+		if res.Failure != nil {
+			b.failures++
+		}
+	}
+	return b.failures > b.Max
+}
@@ -0,0 +1,301 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// blockingTool is a fake handler that reports when a call starts and
+// blocks until the test releases it or its context ends.
+type blockingTool struct {
+	started chan string
+	release map[string]chan struct{}
+
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+type waitArgs struct {
+	Key string `json:"key"`
+}
+
+var waitDeclaration = &genai.FunctionDeclaration{
+	Name: "wait",
+	Parameters: &genai.Schema{
+		Type:       genai.TypeObject,
+		Properties: map[string]*genai.Schema{"key": {Type: genai.TypeString}},
+		Required:   []string{"key"},
+	},
+}
+
+func newBlockingTool(keys ...string) *blockingTool {
+	b := &blockingTool{
+		started: make(chan string, len(keys)),
+		release: map[string]chan struct{}{},
+	}
+	for _, key := range keys {
+		b.release[key] = make(chan struct{})
+	}
+	return b
+}
+
+func (b *blockingTool) handle(ctx context.Context, fc *genai.FunctionCall, args waitArgs) (map[string]any, error) {
+	n := b.running.Add(1)
+	defer b.running.Add(-1)
+	for {
+		m := b.maxRunning.Load()
+		if n <= m || b.maxRunning.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	b.started <- args.Key
+	select {
+	case <-b.release[args.Key]:
+		return map[string]any{"key": args.Key}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitStarted returns the keys of the next n calls that start.
+func (b *blockingTool) waitStarted(t *testing.T, n int) []string {
+	t.Helper()
+	var keys []string
+	for range n {
+		select {
+		case key := <-b.started:
+			keys = append(keys, key)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d calls started", len(keys), n)
+		}
+	}
+	return keys
+}
+
+func waitCall(id, key string) *genai.FunctionCall {
+	return &genai.FunctionCall{ID: id, Name: waitDeclaration.Name, Args: map[string]any{"key": key}}
+}
+
+// runAsync runs calls on r in the background and returns a channel
+// receiving their results.
+func runAsync(r *Runner, calls []*genai.FunctionCall) <-chan []Result {
+	done := make(chan []Result, 1)
+	go func() {
+		done <- r.Run(context.Background(), calls)
+	}()
+	return done
+}
+
+func waitResults(t *testing.T, done <-chan []Result) []Result {
+	t.Helper()
+	select {
+	case results := <-done:
+		return results
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+		return nil
+	}
+}
+
+func TestRunnerReturnsResultsInCallOrder(t *testing.T) {
+	tool := newBlockingTool("a", "b", "c")
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle)
+	runner := NewRunner(registry, 3, time.Minute, nil)
+
+	calls := []*genai.FunctionCall{waitCall("1", "a"), waitCall("2", "b"), waitCall("3", "c")}
+	done := runAsync(runner, calls)
+	tool.waitStarted(t, 3)
+	// Finish the calls in reverse order.
+	for _, key := range []string{"c", "b", "a"} {
+		close(tool.release[key])
+	}
+
+	results := waitResults(t, done)
+	for i, res := range results {
+		if res.Failure != nil || res.Response == nil {
+			t.Fatalf("result %d = %+v, want a response", i, res)
+		}
+		if res.Response.ID != calls[i].ID || res.Response.Response["key"] != calls[i].Args["key"] {
+			t.Errorf("result %d answers %s with %v, want %s", i, res.Response.ID, res.Response.Response, calls[i].ID)
+		}
+	}
+}
+
+func TestRunnerBoundsConcurrency(t *testing.T) {
+	const maxConcurrent = 2
+	keys := []string{"a", "b", "c", "d", "e"}
+	tool := newBlockingTool(keys...)
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle)
+	runner := NewRunner(registry, maxConcurrent, time.Minute, nil)
+
+	var calls []*genai.FunctionCall
+	for i, key := range keys {
+		calls = append(calls, waitCall(fmt.Sprint(i), key))
+	}
+	done := runAsync(runner, calls)
+
+	// Only maxConcurrent calls start; the others wait for a free slot.
+	running := tool.waitStarted(t, maxConcurrent)
+	time.Sleep(20 * time.Millisecond)
+	if len(tool.started) != 0 {
+		t.Fatalf("%d calls started while %d were running", len(tool.started), maxConcurrent)
+	}
+	// Each finished call lets one waiting call start.
+	waiting := len(keys) - maxConcurrent
+	for len(running) > 0 {
+		close(tool.release[running[0]])
+		running = running[1:]
+		if waiting > 0 {
+			running = append(running, tool.waitStarted(t, 1)...)
+			waiting--
+		}
+	}
+
+	results := waitResults(t, done)
+	for i, res := range results {
+		if res.Failure != nil {
+			t.Errorf("result %d failed: %v", i, res.Failure)
+		}
+	}
+	if got := tool.maxRunning.Load(); got != maxConcurrent {
+		t.Errorf("at most %d calls ran at once, want %d", got, maxConcurrent)
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	tool := newBlockingTool("slow", "fast")
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle, WithTimeout(20*time.Millisecond))
+	runner := NewRunner(registry, 2, time.Minute, nil)
+	close(tool.release["fast"])
+
+	results := runner.Run(context.Background(), []*genai.FunctionCall{waitCall("1", "slow"), waitCall("2", "fast")})
+
+	if f := results[0].Failure; f == nil || f.Code != CodeTimeout || !f.Retryable {
+		t.Errorf("slow call failure = %+v, want a retryable %s", f, CodeTimeout)
+	}
+	if results[0].Response == nil || results[0].Response.ID != "1" {
+		t.Errorf("slow call response = %+v, want the failure for call 1", results[0].Response)
+	}
+	if results[1].Failure != nil {
+		t.Errorf("fast call failed: %v", results[1].Failure)
+	}
+}
+
+func TestRunnerDefaultTimeout(t *testing.T) {
+	tool := newBlockingTool("slow")
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle)
+	runner := NewRunner(registry, 1, 20*time.Millisecond, nil)
+
+	results := runner.Run(context.Background(), []*genai.FunctionCall{waitCall("1", "slow")})
+	if f := results[0].Failure; f == nil || f.Code != CodeTimeout {
+		t.Errorf("failure = %+v, want %s", f, CodeTimeout)
+	}
+}
+
+func TestRunnerTimeoutIgnoredContext(t *testing.T) {
+	registry := NewRegistry()
+	unblock := make(chan struct{})
+	defer close(unblock)
+	// A handler that never looks at ctx must not hold up the result.
+	Register(registry, waitDeclaration, func(ctx context.Context, fc *genai.FunctionCall, args waitArgs) (map[string]any, error) {
+		<-unblock
+		return nil, nil
+	}, WithTimeout(20*time.Millisecond))
+	runner := NewRunner(registry, 1, time.Minute, nil)
+
+	done := runAsync(runner, []*genai.FunctionCall{waitCall("1", "stuck")})
+	results := waitResults(t, done)
+	if f := results[0].Failure; f == nil || f.Code != CodeTimeout {
+		t.Errorf("failure = %+v, want %s", f, CodeTimeout)
+	}
+}
+
+func TestRunnerCancel(t *testing.T) {
+	tool := newBlockingTool("cancelled", "kept")
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle)
+	runner := NewRunner(registry, 2, time.Minute, nil)
+
+	done := runAsync(runner, []*genai.FunctionCall{waitCall("1", "cancelled"), waitCall("2", "kept")})
+	tool.waitStarted(t, 2)
+	runner.Cancel([]string{"1", "unknown"})
+	close(tool.release["kept"])
+
+	results := waitResults(t, done)
+	if results[0].Response != nil || results[0].Failure != nil {
+		t.Errorf("cancelled result = %+v, want no response", results[0])
+	}
+	if results[1].Response == nil || results[1].Failure != nil {
+		t.Errorf("kept result = %+v, want a response", results[1])
+	}
+
+	budget := &FailureBudget{Max: 0}
+	if budget.Record(results) {
+		t.Error("a cancelled call counted as a failure")
+	}
+}
+
+func TestRunnerCancelWaitingCall(t *testing.T) {
+	tool := newBlockingTool("running", "waiting")
+	registry := NewRegistry()
+	Register(registry, waitDeclaration, tool.handle)
+	runner := NewRunner(registry, 1, time.Minute, nil)
+
+	done := runAsync(runner, []*genai.FunctionCall{waitCall("1", "running"), waitCall("2", "waiting")})
+	first := tool.waitStarted(t, 1)[0]
+	// Cancel whichever call did not get the only slot.
+	waitingID, waitingKey := "2", "waiting"
+	if first == "waiting" {
+		waitingID, waitingKey = "1", "running"
+	}
+	runner.Cancel([]string{waitingID})
+	close(tool.release[first])
+
+	results := waitResults(t, done)
+	for i, res := range results {
+		if res.Failure != nil {
+			t.Errorf("result %d failed: %v", i, res.Failure)
+		}
+		cancelled := fmt.Sprint(i+1) == waitingID
+		if cancelled != (res.Response == nil) {
+			t.Errorf("result %d = %+v, cancelled %v", i, res, cancelled)
+		}
+	}
+	select {
+	case key := <-tool.started:
+		t.Errorf("cancelled call %s started, want %s never to run", key, waitingKey)
+	default:
+	}
+}
+
+func TestFailureBudget(t *testing.T) {
+	failed := Result{Failure: &Failure{Code: CodeToolFailed}}
+	ok := Result{Response: &genai.FunctionResponse{}}
+
+	budget := &FailureBudget{Max: 2}
+	steps := []struct {
+		results []Result
+		want    bool
+	}{
+		{results: []Result{failed, ok}, want: false},
+		{results: []Result{ok, ok}, want: false},
+		// Successes in between do not reset the count.
+		{results: []Result{failed}, want: false},
+		{results: []Result{failed}, want: true},
+	}
+	for i, step := range steps {
+		if got := budget.Record(step.results); got != step.want {
+			t.Errorf("step %d: Record() = %v, want %v", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// ArgumentError reports a function call argument that does not match the
+// declared schema. Field is the path of the argument, e.g. items[0].course,
+// and empty when the error is not about a single argument.
+type ArgumentError struct {
+	Field   string
+	Message string
+}
+
+func (e *ArgumentError) Error() string {
+	if e.Field == "" {
+		return "invalid arguments: " + e.Message
+	}
+	return "invalid argument " + e.Field + ": " + e.Message
+}
+
+// Validate checks args against an object schema: required properties are
+// present, no unknown properties are given and every value has the
+// declared type and is one of the declared enum values. A nil schema
+// accepts no arguments.
+func Validate(schema *genai.Schema, args map[string]any) error {
+	if schema == nil {
+		if len(args) > 0 {
+			return &ArgumentError{Message: "function takes no arguments"}
+		}
+		return nil
+	}
+	return validateObject("", schema, args)
+}
+
+func validateObject(path string, schema *genai.Schema, obj map[string]any) error {
+	for _, name := range schema.Required {
+		if v, ok := obj[name]; !ok || v == nil {
+			return &ArgumentError{Field: join(path, name), Message: "is required"}
+		}
+	}
+	// Check properties in a fixed order so the same call always reports
+	// the same error.
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		prop, ok := schema.Properties[name]
+		if !ok {
+			return &ArgumentError{Field: join(path, name), Message: "is not a known parameter"}
+		}
+		if err := validateValue(join(path, name), prop, obj[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateValue(path string, schema *genai.Schema, v any) error {
+	if v == nil {
+		// Optional arguments may be sent as null.
+		return nil
+	}
+	switch schema.Type {
+	case genai.TypeString:
+		s, ok := v.(string)
+		if !ok {
+			return &ArgumentError{Field: path, Message: "must be a string"}
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, s) {
+			return &ArgumentError{Field: path, Message: "must be one of " + strings.Join(schema.Enum, ", ")}
+		}
+	case genai.TypeInteger:
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return &ArgumentError{Field: path, Message: "must be an integer"}
+		}
+	case genai.TypeNumber:
+		if _, ok := v.(float64); !ok {
+			return &ArgumentError{Field: path, Message: "must be a number"}
+		}
+	case genai.TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			return &ArgumentError{Field: path, Message: "must be a boolean"}
+		}
+	case genai.TypeArray:
+		items, ok := v.([]any)
+		if !ok {
+			return &ArgumentError{Field: path, Message: "must be an array"}
+		}
+		if schema.Items != nil {
+			for i, item := range items {
+				if err := validateValue(fmt.Sprintf("%s[%d]", path, i), schema.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+	case genai.TypeObject:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return &ArgumentError{Field: path, Message: "must be an object"}
+		}
+		return validateObject(path, schema, obj)
+	}
+	return nil
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+var testOrderSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"user_email": {Type: genai.TypeString},
+		"status":     {Type: genai.TypeString, Enum: []string{"pending", "paid"}},
+		"gift":       {Type: genai.TypeBoolean},
+		"budget":     {Type: genai.TypeNumber},
+		"items": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"course":   {Type: genai.TypeString},
+					"quantity": {Type: genai.TypeInteger},
+				},
+				Required: []string{"course"},
+			},
+		},
+		"address": {
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"country": {Type: genai.TypeString},
+			},
+			Required: []string{"country"},
+		},
+	},
+	Required: []string{"user_email"},
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    *genai.Schema
+		args      map[string]any
+		wantField string
+		wantMsg   string
+	}{
+		{name: "valid", schema: testOrderSchema, args: map[string]any{
+			"user_email": "a@example.com",
+			"status":     "paid",
+			"gift":       true,
+			"budget":     9.5,
+			"items":      []any{map[string]any{"course": "go", "quantity": float64(2)}},
+			"address":    map[string]any{"country": "DE"},
+		}},
+		{name: "optional null", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "status": nil}},
+		{name: "missing required", schema: testOrderSchema, args: map[string]any{}, wantField: "user_email", wantMsg: "is required"},
+		{name: "required null", schema: testOrderSchema, args: map[string]any{"user_email": nil}, wantField: "user_email", wantMsg: "is required"},
+		{name: "unknown property", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "coupon": "X"}, wantField: "coupon", wantMsg: "is not a known parameter"},
+		{name: "not a string", schema: testOrderSchema, args: map[string]any{"user_email": float64(1)}, wantField: "user_email", wantMsg: "must be a string"},
+		{name: "not in enum", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "status": "lost"}, wantField: "status", wantMsg: "must be one of pending, paid"},
+		{name: "not a boolean", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "gift": "yes"}, wantField: "gift", wantMsg: "must be a boolean"},
+		{name: "not a number", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "budget": "10"}, wantField: "budget", wantMsg: "must be a number"},
+		{name: "not an array", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "items": "go"}, wantField: "items", wantMsg: "must be an array"},
+		{name: "not an object", schema: testOrderSchema, args: map[string]any{"user_email": "a@example.com", "address": "Berlin"}, wantField: "address", wantMsg: "must be an object"},
+		{name: "fractional integer", schema: testOrderSchema, args: map[string]any{
+			"user_email": "a@example.com",
+			"items":      []any{map[string]any{"course": "go", "quantity": 1.5}},
+		}, wantField: "items[0].quantity", wantMsg: "must be an integer"},
+		{name: "integer as string", schema: testOrderSchema, args: map[string]any{
+			"user_email": "a@example.com",
+			"items":      []any{map[string]any{"course": "go", "quantity": "2"}},
+		}, wantField: "items[0].quantity", wantMsg: "must be an integer"},
+		{name: "nested required", schema: testOrderSchema, args: map[string]any{
+			"user_email": "a@example.com",
+			"items":      []any{map[string]any{"course": "go"}, map[string]any{"quantity": float64(1)}},
+		}, wantField: "items[1].course", wantMsg: "is required"},
+		{name: "nested unknown", schema: testOrderSchema, args: map[string]any{
+			"user_email": "a@example.com",
+			"address":    map[string]any{"country": "DE", "city": "Berlin"},
+		}, wantField: "address.city", wantMsg: "is not a known parameter"},
+		// Properties are checked in name order, so the first error is stable.
+		{name: "several errors", schema: testOrderSchema, args: map[string]any{
+			"user_email": "a@example.com",
+			"status":     "lost",
+			"gift":       "yes",
+		}, wantField: "gift", wantMsg: "must be a boolean"},
+		{name: "nil schema", schema: nil, args: nil},
+		{name: "nil schema with arguments", schema: nil, args: map[string]any{"query": "go"}, wantMsg: "function takes no arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.schema, tt.args)
+			if tt.wantMsg == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			var ae *ArgumentError
+			if !errors.As(err, &ae) {
+				t.Fatalf("Validate() = %v, want an *ArgumentError", err)
+			}
+			if ae.Field != tt.wantField || ae.Message != tt.wantMsg {
+				t.Errorf("Validate() = {%q, %q}, want {%q, %q}", ae.Field, ae.Message, tt.wantField, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestArgumentErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  *ArgumentError
+		want string
+	}{
+		{err: &ArgumentError{Field: "items[0].course", Message: "is required"}, want: "invalid argument items[0].course: is required"},
+		{err: &ArgumentError{Message: "function takes no arguments"}, want: "invalid arguments: function takes no arguments"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}